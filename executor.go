@@ -1,58 +1,224 @@
 package promise
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"runtime/debug"
 	"sync"
+	"time"
 )
 
-var ErrExecutorStopped = errors.New("executor is stopped")
+var (
+	ErrExecutorStopped = errors.New("executor is stopped")
+	// ErrExecutorFull is returned by TryExec if the executor is at its
+	// capacity, see Executor.Cap. It is the counterpart of ErrRunnerFull
+	// from v2, named after the Executor like ErrExecutorStopped.
+	ErrExecutorFull = errors.New("executor is full")
+)
 
 type PromiseFunc func() (interface{}, error)
 
 type executionPromise struct {
 	*Promise
-	fn PromiseFunc
+	// fn receives the executor which executes the promise. It could differ
+	// from the executor the promise was submitted to, if the promise was
+	// handed off to another executor.
+	fn      func(e *Executor) (interface{}, error)
+	timeout time.Duration
+}
+
+// PanicError is the error of a promise whose function panicked
+type PanicError struct {
+	// Value is the value recovered from the panic
+	Value interface{}
+	// Stack is the stack trace of the goroutine which panicked
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("promise function panicked: %v", e.Value)
+}
+
+// Unwrap returns the recovered value if it is an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// TimeoutError is the error of a promise whose function did not return within
+// the timeout passed to ExecTimeout. It matches context.DeadlineExceeded.
+type TimeoutError struct {
+	Timeout time.Duration
+	freed   chan struct{}
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("promise function timed out after %v", e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// Freed returns a channel which is closed once the timed out function returns
+// and the worker executing it is freed. The channel is never closed if the
+// function never returns.
+func (e *TimeoutError) Freed() <-chan struct{} {
+	return e.freed
 }
 
 type Executor struct {
-	stopCh chan struct{}
-	promCh chan *executionPromise
-	wg     sync.WaitGroup
+	stopCh  chan struct{}
+	promCh  chan *executionPromise
+	wg      sync.WaitGroup
+	onPanic func(*PanicError)
+
+	mu        sync.Mutex
+	workers   []chan struct{}     // closing the channel makes the worker exit
+	callbacks []*executionPromise // queued regardless of the capacity
+	wakeup    chan struct{}       // signals workers about queued callbacks
+}
+
+// ExecutorOption configures the Executor
+type ExecutorOption func(*Executor)
+
+// WithPanicHandler sets fn to be called each time a function executed by the
+// Executor panics. The panic is recovered anyway and the promise of the
+// function is rejected with *PanicError, fn is only a notification.
+func WithPanicHandler(fn func(*PanicError)) ExecutorOption {
+	return func(e *Executor) {
+		e.onPanic = fn
+	}
 }
 
-func StartExecutor(concurrency int, maxPendingPromises int) *Executor {
+func StartExecutor(concurrency int, maxPendingPromises int, opts ...ExecutorOption) *Executor {
 	e := &Executor{
 		stopCh: make(chan struct{}),
 		promCh: make(chan *executionPromise, maxPendingPromises),
+		wakeup: make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(e)
 	}
+	e.Resize(concurrency)
+
+	return e
+}
 
-	for i := 0; i < concurrency; i++ {
+// Resize changes the number of workers of the executor to n. New workers are
+// started immediately, while extra workers exit once they are done with their
+// current promise. Resize does nothing if the executor is stopped.
+func (e *Executor) Resize(n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopped() {
+		return
+	}
+	for len(e.workers) < n {
+		quit := make(chan struct{})
+		e.workers = append(e.workers, quit)
 		e.wg.Add(1)
-		go func() {
-			defer e.wg.Done()
-			for {
-				select {
-				case <-e.stopCh:
-					return
-				default:
-				}
+		go e.work(quit)
+	}
+	for len(e.workers) > n && len(e.workers) > 0 {
+		last := len(e.workers) - 1
+		close(e.workers[last])
+		e.workers = e.workers[:last]
+	}
+}
 
-				select {
-				case <-e.stopCh:
-					return
-				case p := <-e.promCh:
-					res, err := p.fn()
-					if err != nil {
-						p.Reject(err)
-					} else {
-						p.Resolve(res)
-					}
-				}
-			}
-		}()
+func (e *Executor) work(quit chan struct{}) {
+	defer e.wg.Done()
+	for {
+		select {
+		case <-e.stopCh:
+			return
+		case <-quit:
+			return
+		default:
+		}
+
+		if ep := e.nextCallback(); ep != nil {
+			e.run(ep)
+			continue
+		}
+
+		select {
+		case <-e.stopCh:
+			return
+		case <-quit:
+			return
+		case <-e.wakeup:
+		case p := <-e.promCh:
+			e.run(p)
+		}
 	}
+}
 
-	return e
+// nextCallback removes the first queued callback and returns it. It returns
+// nil if there are no queued callbacks.
+func (e *Executor) nextCallback() *executionPromise {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.callbacks) == 0 {
+		return nil
+	}
+	ep := e.callbacks[0]
+	e.callbacks[0] = nil
+	e.callbacks = e.callbacks[1:]
+	if len(e.callbacks) > 0 {
+		// let another worker pick up the rest
+		e.signal()
+	}
+	return ep
+}
+
+// signal wakes up a worker waiting for promises
+func (e *Executor) signal() {
+	select {
+	case e.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// run executes the promise function, converting a panic or exceeded timeout
+// into the rejection of the promise
+func (e *Executor) run(p *executionPromise) {
+	if p.timeout > 0 {
+		freed := make(chan struct{})
+		defer close(freed)
+		timer := time.AfterFunc(p.timeout, func() {
+			p.Reject(&TimeoutError{Timeout: p.timeout, freed: freed})
+		})
+		defer timer.Stop()
+	}
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		err := &PanicError{Value: v, Stack: debug.Stack()}
+		p.Reject(err)
+		if e.onPanic != nil {
+			e.onPanic(err)
+		}
+	}()
+
+	select {
+	case <-p.Done():
+		// promise was canceled while waiting for execution,
+		// so there is no need to execute it.
+		return
+	default:
+	}
+
+	res, err := p.fn(e)
+	if err != nil {
+		p.Reject(err)
+	} else {
+		p.Resolve(res)
+	}
 }
 
 // Cap return the maximum amount of promises this Executor can handle
@@ -61,23 +227,81 @@ func (e *Executor) Cap() int {
 	return cap(e.promCh)
 }
 
-func (e *Executor) Stop() {
+func (e *Executor) stopped() bool {
 	select {
 	case <-e.stopCh:
-		return
+		return true
 	default:
+		return false
+	}
+}
+
+func (e *Executor) Stop() {
+	// cancel all pending promises
+	for _, t := range e.Handoff() {
+		t.Reject(ErrExecutorStopped)
 	}
+}
+
+// Task is a promise function which was submitted to an executor, but not
+// started. Its promise stays pending until the task is either submitted to
+// another executor or rejected.
+type Task struct {
+	ep *executionPromise
+}
 
+// Promise returns the promise of the task
+func (t Task) Promise() *Promise {
+	return t.ep.Promise
+}
+
+// Submit schedules the task for execution on the executor e, the same way
+// Exec does.
+func (t Task) Submit(e *Executor) {
+	e.enqueue(context.Background(), t.ep)
+}
+
+// Reject rejects the promise of the task
+func (t Task) Reject(err error) {
+	t.ep.Reject(err)
+}
+
+// Handoff stops the executor the same way Stop does, but instead of rejecting
+// pending promises returns them as tasks, so they could be submitted to
+// another executor. Promises which were done while pending (e.g. canceled)
+// are not returned.
+func (e *Executor) Handoff() []Task {
+	e.mu.Lock()
+	if e.stopped() {
+		e.mu.Unlock()
+		return nil
+	}
+	// close(e.stopCh) also cancels contexts of all running
+	// promises started with ExecContext.
 	close(e.stopCh)
+	e.workers = nil
+	callbacks := e.callbacks
+	e.callbacks = nil
+	e.mu.Unlock()
 	e.wg.Wait()
 
-	// cancel all pending promises
+	// callbacks are never handed off
+	for _, ep := range callbacks {
+		e.run(ep)
+	}
+
+	var tasks []Task
 	for {
 		select {
 		case ep := <-e.promCh:
-			ep.Reject(ErrExecutorStopped)
+			select {
+			case <-ep.Done():
+				continue
+			default:
+			}
+			tasks = append(tasks, Task{ep: ep})
 		default:
-			return
+			return tasks
 		}
 	}
 }
@@ -85,9 +309,95 @@ func (e *Executor) Stop() {
 func (e *Executor) Exec(fn PromiseFunc) *Promise {
 	ep := &executionPromise{
 		Promise: New(),
-		fn:      fn,
+		fn: func(*Executor) (interface{}, error) {
+			return fn()
+		},
+	}
+	e.enqueue(context.Background(), ep)
+	return ep.Promise
+}
+
+// ExecContext is the same as Exec, but fn accepts the context. The context
+// passed to fn is derived from ctx and is canceled once ctx is done, the
+// returned promise is done (e.g. canceled) or the executor executing fn is
+// stopped.
+//
+// While the executor is at its capacity ExecContext blocks the caller until
+// ctx is done. In this case the returned promise is rejected with the error of
+// ctx.
+func (e *Executor) ExecContext(ctx context.Context, fn func(context.Context) (interface{}, error)) *Promise {
+	ctx, ep := execContext(ctx, fn)
+	e.enqueue(ctx, ep)
+	return ep.Promise
+}
+
+// ExecTimeout is the same as ExecContext, but limits the execution time of fn
+// to d. If fn does not return in time, then the returned promise is rejected
+// with *TimeoutError and the context of fn is canceled. fn itself can not be
+// interrupted, so the worker executing it stays busy until it returns.
+func (e *Executor) ExecTimeout(ctx context.Context, d time.Duration, fn func(context.Context) (interface{}, error)) *Promise {
+	ctx, ep := execContext(ctx, fn)
+	ep.timeout = d
+	e.enqueue(ctx, ep)
+	return ep.Promise
+}
+
+// execContext returns the execution promise of fn as described in
+// ExecContext together with the context derived from ctx
+func execContext(ctx context.Context, fn func(context.Context) (interface{}, error)) (context.Context, *executionPromise) {
+	ctx, cancel := context.WithCancel(ctx)
+	ep := &executionPromise{
+		Promise: New(),
+		fn: func(e *Executor) (interface{}, error) {
+			go func() {
+				select {
+				case <-e.stopCh:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			return fn(ctx)
+		},
 	}
+	ep.whenDone(cancel)
+	return ctx, ep
+}
+
+// enqueue sends ep to the promises channel and blocks while the executor is
+// at its capacity. If ctx is done before ep is sent, then ep is rejected with
+// the error of ctx.
+func (e *Executor) enqueue(ctx context.Context, ep *executionPromise) {
 	// Try to send it to promises channel
+	select {
+	case <-e.stopCh:
+		ep.Reject(ErrExecutorStopped)
+		return
+	case <-ctx.Done():
+		ep.Reject(ctx.Err())
+		return
+	default:
+	}
+
+	select {
+	case <-e.stopCh:
+		ep.Reject(ErrExecutorStopped)
+	case <-ctx.Done():
+		ep.Reject(ctx.Err())
+	case e.promCh <- ep:
+	}
+}
+
+// TryExec is the same as Exec, but never blocks the caller. If the executor
+// is at its capacity (see Cap), then the returned promise is rejected with
+// ErrExecutorFull.
+func (e *Executor) TryExec(fn PromiseFunc) *Promise {
+	ep := &executionPromise{
+		Promise: New(),
+		fn: func(*Executor) (interface{}, error) {
+			return fn()
+		},
+	}
+
 	select {
 	case <-e.stopCh:
 		ep.Reject(ErrExecutorStopped)
@@ -99,41 +409,109 @@ func (e *Executor) Exec(fn PromiseFunc) *Promise {
 	case <-e.stopCh:
 		ep.Reject(ErrExecutorStopped)
 	case e.promCh <- ep:
+	default:
+		ep.Reject(ErrExecutorFull)
 	}
 	return ep.Promise
 }
 
+// dispatch schedules fn for execution on the executor without blocking the
+// caller. Callbacks are queued regardless of the capacity of the executor and
+// are started in the order of dispatching. If executor is stopped, then fn is
+// called inline.
+func (e *Executor) dispatch(fn func()) {
+	e.mu.Lock()
+	if e.stopped() {
+		e.mu.Unlock()
+		fn()
+		return
+	}
+	e.callbacks = append(e.callbacks, &executionPromise{
+		Promise: New(),
+		fn: func(*Executor) (interface{}, error) {
+			fn()
+			return nil, nil
+		},
+	})
+	e.signal()
+	e.mu.Unlock()
+}
+
 // WhenAll return the list of promises results corresponding to the promises list p
-// if any promise in p failes - fails with that error.
+// if any promise in p failes - fails with that error as soon as it fails.
+// The result is collected from completion notifications of p, so it does not
+// occupy any worker of the executor e. If e is stopped, then the returned
+// promise is rejected with ErrExecutorStopped.
 // NOTE: This function doesn't cancel rest of the promises in p on error.
 func WhenAll(e *Executor, p ...*Promise) *Promise {
-	np := e.Exec(func() (interface{}, error) {
-		l := make([]interface{}, len(p))
-		for i := range p {
-			res, err := p[i].Result()
-			if err != nil {
-				return nil, err
+	np := New()
+	if e.stopped() {
+		np.Reject(ErrExecutorStopped)
+		return np
+	}
+
+	var mu sync.Mutex
+	l := make([]interface{}, len(p))
+	pending := len(p)
+	if pending == 0 {
+		np.Resolve(l)
+		return np
+	}
+	for i := range p {
+		i := i
+		p[i].whenDone(func() {
+			if p[i].err != nil {
+				np.Reject(p[i].err)
+				return
 			}
-			l[i] = res
-		}
-		return l, nil
-	})
+
+			mu.Lock()
+			l[i] = p[i].res
+			pending--
+			done := pending == 0
+			mu.Unlock()
+			if done {
+				np.Resolve(l)
+			}
+		})
+	}
 	return np
 }
 
 // WhenAny return the first result for the list op promises p. If all promises in
-// the promises list p were failed - returns the error of last failed promise.
+// the promises list p were failed - returns the error of last failed promise
+// in the promises list p. The result is collected from completion notifications
+// of p, so it does not occupy any worker of the executor e. If e is stopped,
+// then the returned promise is rejected with ErrExecutorStopped.
 func WhenAny(e *Executor, p ...*Promise) *Promise {
-	np := e.Exec(func() (interface{}, error) {
-		var res interface{}
-		var err error
-		for i := range p {
-			res, err = p[i].Result()
-			if err == nil {
-				return res, nil
+	np := New()
+	if e.stopped() {
+		np.Reject(ErrExecutorStopped)
+		return np
+	}
+
+	var mu sync.Mutex
+	pending := len(p)
+	if pending == 0 {
+		np.Resolve(nil)
+		return np
+	}
+	for i := range p {
+		i := i
+		p[i].whenDone(func() {
+			if p[i].err == nil {
+				np.Resolve(p[i].res)
+				return
 			}
-		}
-		return nil, err
-	})
+
+			mu.Lock()
+			pending--
+			done := pending == 0
+			mu.Unlock()
+			if done {
+				np.Reject(p[len(p)-1].err)
+			}
+		})
+	}
 	return np
 }
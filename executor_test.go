@@ -2,8 +2,11 @@ package promise
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"runtime"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -225,3 +228,516 @@ func TestWhenAnyTakesLastError(t *testing.T) {
 		t.Errorf("unexpected error")
 	}
 }
+
+func TestPromiseCallbacksOnExecutor(t *testing.T) {
+	e := StartExecutor(1, 100)
+	defer e.Stop()
+
+	p := New()
+	called := make(chan interface{}, 1)
+	p.OnResolveOnExecutor(e, func(v interface{}) {
+		called <- v
+	})
+	p.Resolve("hello world")
+
+	select {
+	case v := <-called:
+		if v.(string) != "hello world" {
+			t.Logf("exp: %s", "hello world")
+			t.Logf("got: %v", v)
+			t.Error("unexpected callback value")
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("callback was not called on executor")
+	}
+}
+
+func TestPromiseCallbacksOnFullExecutorKeepOrder(t *testing.T) {
+	e := StartExecutor(1, 1)
+	defer e.Stop()
+
+	// occupy the only worker and fill the queue
+	release := make(chan struct{})
+	started := make(chan struct{})
+	_ = e.Exec(func() (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+	_ = e.Exec(func() (interface{}, error) {
+		return nil, nil
+	})
+
+	const n = 100
+	p := New()
+	order := make(chan int, n)
+	for i := 0; i < n; i++ {
+		i := i
+		p.FinallyOnExecutor(e, func() {
+			order <- i
+		})
+	}
+
+	goroutines := runtime.NumGoroutine()
+	resolved := make(chan struct{})
+	go func() {
+		defer close(resolved)
+		p.Resolve("hello world")
+	}()
+	select {
+	case <-resolved:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("resolve is blocked by full executor")
+	}
+	if spawned := runtime.NumGoroutine() - goroutines; spawned > 0 {
+		t.Errorf("callbacks spawned %d goroutines", spawned)
+	}
+	close(release)
+
+	for i := 0; i < n; i++ {
+		select {
+		case actual := <-order:
+			if actual != i {
+				t.Logf("exp: %d", i)
+				t.Logf("got: %d", actual)
+				t.Fatalf("unexpected order of callbacks")
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("callback %d was not called", i)
+		}
+	}
+}
+
+func TestPromiseCallbacksOnStoppedExecutorAreCalledInline(t *testing.T) {
+	e := StartExecutor(1, 100)
+	e.Stop()
+
+	p := New()
+	called := false
+	p.FinallyOnExecutor(e, func() {
+		called = true
+	})
+	p.Resolve("hello world")
+
+	if !called {
+		t.Error("callback was not called inline")
+	}
+}
+
+func TestWhenAllDoesNotOccupyExecutorWorkers(t *testing.T) {
+	e := StartExecutor(1, 100)
+	defer e.Stop()
+
+	p1 := New()
+	p2 := New()
+	all := WhenAll(e, p1, p2)
+	first := WhenAny(e, p1, p2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// the only worker must be free while p1 and p2 are pending
+	free := e.Exec(func() (interface{}, error) {
+		return nil, nil
+	})
+	_, err := free.ResultWithContext(ctx)
+
+	p1.Resolve("hello")
+	p2.Resolve("world")
+	if err != nil {
+		t.Fatalf("worker is occupied by pending aggregation: %v", err)
+	}
+
+	if _, err := all.ResultWithContext(ctx); err != nil {
+		t.Fatalf("unexpected error: %[1]v (%[1]T)", err)
+	}
+	if _, err := first.ResultWithContext(ctx); err != nil {
+		t.Fatalf("unexpected error: %[1]v (%[1]T)", err)
+	}
+}
+
+func TestWhenAllFailsOnFirstRejection(t *testing.T) {
+	e := StartExecutor(4, 100)
+	defer e.Stop()
+
+	expectedError := errors.New("hello world")
+	p1 := New()
+	p2 := New()
+	all := WhenAll(e, p1, p2)
+
+	p2.Reject(expectedError)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := all.ResultWithContext(ctx)
+	if err != expectedError {
+		t.Logf("exp: %v", expectedError)
+		t.Logf("got: %v", err)
+		t.Errorf("unexpected error")
+	}
+}
+
+func TestPromiseExecutorRecoversPanics(t *testing.T) {
+	panics := make(chan *PanicError, 1)
+	e := StartExecutor(1, 100, WithPanicHandler(func(err *PanicError) {
+		panics <- err
+	}))
+	defer e.Stop()
+
+	p := e.Exec(func() (interface{}, error) {
+		panic("hello world")
+	})
+
+	_, err := p.Result()
+	panicErr, ok := err.(*PanicError)
+	if !ok {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if panicErr.Value != "hello world" {
+		t.Logf("exp: %v", "hello world")
+		t.Logf("got: %v", panicErr.Value)
+		t.Error("unexpected panic value")
+	}
+
+	select {
+	case notified := <-panics:
+		if notified != panicErr {
+			t.Error("panic handler got unexpected error")
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("panic handler was not called")
+	}
+
+	// the only worker of the executor should survive the panic
+	v, err := e.Exec(func() (interface{}, error) {
+		return "hello world", nil
+	}).Result()
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if v.(string) != "hello world" {
+		t.Logf("exp: %s", "hello world")
+		t.Logf("got: %v", v)
+		t.Error("unexpected promise value")
+	}
+}
+
+func TestPromiseExecutorExecContextCancelsWithCallerContext(t *testing.T) {
+	e := StartExecutor(1, 100)
+	defer e.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	p := e.ExecContext(ctx, func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	<-started
+	cancel()
+
+	_, err := p.Result()
+	if err != context.Canceled {
+		t.Logf("exp: %v", context.Canceled)
+		t.Logf("got: %v", err)
+		t.Error("unexpected promise error")
+	}
+}
+
+func TestPromiseExecutorExecContextCancelsWithExecutor(t *testing.T) {
+	e := StartExecutor(1, 100)
+
+	started := make(chan struct{})
+	p := e.ExecContext(context.Background(), func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		e.Stop()
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("running promise context was not canceled by executor stop")
+	}
+
+	_, err := p.Result()
+	if err != context.Canceled {
+		t.Logf("exp: %v", context.Canceled)
+		t.Logf("got: %v", err)
+		t.Error("unexpected promise error")
+	}
+}
+
+func TestPromiseExecutorDoesNotExecuteCanceledPromises(t *testing.T) {
+	e := StartExecutor(1, 100)
+	defer e.Stop()
+
+	release := make(chan struct{})
+	_ = e.Exec(func() (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+
+	executed := make(chan struct{}, 1)
+	p := e.Exec(func() (interface{}, error) {
+		executed <- struct{}{}
+		return nil, nil
+	})
+	p.Cancel()
+	close(release)
+
+	_, _ = e.Exec(func() (interface{}, error) {
+		return nil, nil
+	}).Result()
+
+	select {
+	case <-executed:
+		t.Error("canceled promise was executed")
+	default:
+	}
+}
+
+func TestPromiseCancelPropagatesIntoExecContext(t *testing.T) {
+	e := StartExecutor(1, 100)
+	defer e.Stop()
+
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	p := e.ExecContext(context.Background(), func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		close(canceled)
+		return nil, ctx.Err()
+	})
+	<-started
+	p.Cancel()
+
+	select {
+	case <-canceled:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("promise context was not canceled")
+	}
+}
+
+func TestPromiseExecutorHandoffReturnsPendingTasks(t *testing.T) {
+	// executor without workers never starts pending promises
+	e1 := StartExecutor(0, 100)
+
+	pending := e1.Exec(func() (interface{}, error) {
+		return "hello world", nil
+	})
+	pendingCtx := e1.ExecContext(context.Background(), func(ctx context.Context) (interface{}, error) {
+		return "hello context", ctx.Err()
+	})
+	canceled := e1.Exec(func() (interface{}, error) {
+		return nil, nil
+	})
+	canceled.Cancel()
+
+	tasks := e1.Handoff()
+	if len(tasks) != 2 {
+		t.Fatalf("unexpected number of handed off tasks: %d", len(tasks))
+	}
+	if tasks[0].Promise() != pending {
+		t.Fatalf("unexpected promise of handed off task")
+	}
+
+	e2 := StartExecutor(1, 100)
+	defer e2.Stop()
+	for _, task := range tasks {
+		task.Submit(e2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	v, err := pending.ResultWithContext(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if v.(string) != "hello world" {
+		t.Logf("exp: %s", "hello world")
+		t.Logf("got: %v", v)
+		t.Error("unexpected value of handed off promise")
+	}
+
+	v, err = pendingCtx.ResultWithContext(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if v.(string) != "hello context" {
+		t.Logf("exp: %s", "hello context")
+		t.Logf("got: %v", v)
+		t.Error("unexpected value of handed off promise")
+	}
+}
+
+func TestPromiseExecutorResize(t *testing.T) {
+	e := StartExecutor(1, 100)
+	defer e.Stop()
+
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		_ = e.Exec(func() (interface{}, error) {
+			started <- struct{}{}
+			<-release
+			return nil, nil
+		})
+	}
+
+	e.Resize(3)
+	for i := 0; i < 3; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d promises started after executor was resized", i)
+		}
+	}
+
+	e.Resize(1)
+	close(release)
+
+	// after shrinking only one promise could be executed at a time
+	var running, maxRunning int32
+	l := make([]*Promise, 3)
+	for i := range l {
+		l[i] = e.Exec(func() (interface{}, error) {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return nil, nil
+		})
+	}
+	for i := range l {
+		_, _ = l[i].Result()
+	}
+
+	if maxRunning != 1 {
+		t.Errorf("unexpected number of concurrently running promises: %d", maxRunning)
+	}
+}
+
+func TestPromiseExecutorTryExecOnFullExecutor(t *testing.T) {
+	// executor without workers never starts pending promises
+	e := StartExecutor(0, 1)
+	defer e.Stop()
+
+	pending := e.TryExec(func() (interface{}, error) {
+		return nil, nil
+	})
+	select {
+	case <-pending.Done():
+		_, err := pending.Result()
+		t.Fatalf("unexpected error of pending promise: %v", err)
+	default:
+	}
+
+	full := e.TryExec(func() (interface{}, error) {
+		return nil, nil
+	})
+	select {
+	case <-full.Done():
+	default:
+		t.Fatalf("promise on full executor is not rejected immediately")
+	}
+	if _, err := full.Result(); err != ErrExecutorFull {
+		t.Logf("exp: %v", ErrExecutorFull)
+		t.Logf("got: %v", err)
+		t.Error("unexpected error of promise on full executor")
+	}
+}
+
+func TestPromiseExecutorExecContextOnFullExecutorIsBoundedByContext(t *testing.T) {
+	e := StartExecutor(0, 1)
+	defer e.Stop()
+
+	_ = e.Exec(func() (interface{}, error) {
+		return nil, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	submitted := make(chan *Promise)
+	go func() {
+		submitted <- e.ExecContext(ctx, func(context.Context) (interface{}, error) {
+			return nil, nil
+		})
+	}()
+
+	select {
+	case p := <-submitted:
+		_, err := p.Result()
+		if err != context.DeadlineExceeded {
+			t.Logf("exp: %v", context.DeadlineExceeded)
+			t.Logf("got: %v", err)
+			t.Error("unexpected error of promise on full executor")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("submit is not bounded by context")
+	}
+}
+
+func TestPromiseExecutorExecTimeoutIsRejectedWithTimeoutError(t *testing.T) {
+	e := StartExecutor(1, 100)
+	defer e.Stop()
+
+	release := make(chan struct{})
+	p := e.ExecTimeout(context.Background(), 10*time.Millisecond, func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		// ignore cancelation for a while
+		<-release
+		return "late", nil
+	})
+
+	_, err := p.Result()
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("timeout error does not match context.DeadlineExceeded")
+	}
+
+	select {
+	case <-timeoutErr.Freed():
+		t.Fatalf("worker is freed while the function is running")
+	default:
+	}
+	close(release)
+	select {
+	case <-timeoutErr.Freed():
+	case <-time.After(time.Second):
+		t.Fatalf("worker is not freed after the function returned")
+	}
+}
+
+func TestPromiseExecutorExecTimeoutResolvesInTime(t *testing.T) {
+	e := StartExecutor(1, 100)
+	defer e.Stop()
+
+	actual, err := e.ExecTimeout(context.Background(), time.Second, func(context.Context) (interface{}, error) {
+		return 1, nil
+	}).Result()
+	if err != nil || actual != 1 {
+		t.Logf("exp: 1 <nil>")
+		t.Logf("got: %v %v", actual, err)
+		t.Error("unexpected result")
+	}
+}
@@ -3,15 +3,18 @@ package promise
 import (
 	"context"
 	"errors"
+	"sync"
 )
 
 var ErrCanceled = errors.New("promise canceled")
 
 // Promise structure which defines a promise
 type Promise struct {
-	done chan struct{}
-	res  interface{}
-	err  error
+	mu        sync.Mutex
+	done      chan struct{}
+	res       interface{}
+	err       error
+	callbacks []func()
 }
 
 // New intializes the promise which must be resolved or rejected later
@@ -44,7 +47,10 @@ func (p *Promise) ResultWithContext(ctx context.Context) (interface{}, error) {
 	}
 }
 
-// Cancel cancel the promise, by failing it with ErrCanceled
+// Cancel cancel the promise, by failing it with ErrCanceled. If the promise
+// function is not started by the Executor yet, then it is never executed. If
+// the promise function is already running and was started with ExecContext,
+// then its context is canceled.
 func (p *Promise) Cancel() {
 	p.Reject(ErrCanceled)
 }
@@ -70,15 +76,94 @@ func (p *Promise) Reject(err error) {
 }
 
 func (p *Promise) finalize(v interface{}, err error) {
+	p.mu.Lock()
 	select {
 	case <-p.Done():
 		// ignore all finalizations but the first one
+		p.mu.Unlock()
 		return
 	default:
-		p.res = v
-		p.err = err
-		close(p.done)
 	}
+	p.res = v
+	p.err = err
+	close(p.done)
+	callbacks := p.callbacks
+	p.callbacks = nil
+	p.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn()
+	}
+}
+
+// whenDone calls fn once the promise is either resolved or rejected. If
+// promise is already done, then fn is called immediately.
+func (p *Promise) whenDone(fn func()) {
+	p.mu.Lock()
+	select {
+	case <-p.Done():
+		p.mu.Unlock()
+		fn()
+	default:
+		p.callbacks = append(p.callbacks, fn)
+		p.mu.Unlock()
+	}
+}
+
+// OnResolve registers fn to be called with the result of the promise once it
+// is resolved. fn is never called if the promise is rejected.
+//
+// Callbacks are called in the order of registration on the goroutine which
+// resolves or rejects the promise, after Done chanel is closed. If the
+// promise is already done, then fn is called immediately on the calling
+// goroutine.
+func (p *Promise) OnResolve(fn func(interface{})) {
+	p.whenDone(func() {
+		if p.err == nil {
+			fn(p.res)
+		}
+	})
+}
+
+// OnReject registers fn to be called with the error of the promise once it is
+// rejected. fn is never called if the promise is resolved. See OnResolve for
+// the order in which callbacks are called.
+func (p *Promise) OnReject(fn func(error)) {
+	p.whenDone(func() {
+		if p.err != nil {
+			fn(p.err)
+		}
+	})
+}
+
+// Finally registers fn to be called once the promise is either resolved or
+// rejected. See OnResolve for the order in which callbacks are called.
+func (p *Promise) Finally(fn func()) {
+	p.whenDone(fn)
+}
+
+// OnResolveOnExecutor is the same as OnResolve, but fn is executed on the
+// executor e. If e is stopped, then fn is called inline.
+func (p *Promise) OnResolveOnExecutor(e *Executor, fn func(interface{})) {
+	p.OnResolve(func(v interface{}) {
+		e.dispatch(func() { fn(v) })
+	})
+}
+
+// OnRejectOnExecutor is the same as OnReject, but fn is executed on the
+// executor e. If e is stopped, then fn is called inline.
+func (p *Promise) OnRejectOnExecutor(e *Executor, fn func(error)) {
+	p.OnReject(func(err error) {
+		e.dispatch(func() { fn(err) })
+	})
+}
+
+// FinallyOnExecutor is the same as Finally, but fn is executed on the
+// executor e. If e is stopped, then fn is called inline.
+func (p *Promise) FinallyOnExecutor(e *Executor, fn func()) {
+	p.Finally(func() {
+		e.dispatch(fn)
+	})
 }
 
 // CancelAll cancel all promises
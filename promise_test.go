@@ -177,3 +177,49 @@ func TestCancelAll(t *testing.T) {
 		}
 	}
 }
+
+func TestPromiseCallbacks(t *testing.T) {
+	p := New()
+
+	var calls []string
+	p.OnResolve(func(v interface{}) {
+		calls = append(calls, "resolve:"+v.(string))
+	})
+	p.OnReject(func(err error) {
+		calls = append(calls, "reject")
+	})
+	p.Finally(func() {
+		calls = append(calls, "finally")
+	})
+
+	p.Resolve("hello")
+	p.Reject(errors.New("hello world"))
+
+	expected := []string{"resolve:hello", "finally"}
+	if len(calls) != len(expected) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Logf("exp: %v", expected)
+			t.Logf("got: %v", calls)
+			t.Fatalf("unexpected calls order")
+		}
+	}
+}
+
+func TestPromiseCallbacksOnDonePromise(t *testing.T) {
+	p := New()
+	p.Cancel()
+
+	var actual error
+	p.OnReject(func(err error) {
+		actual = err
+	})
+
+	if actual != ErrCanceled {
+		t.Logf("exp: %v", ErrCanceled)
+		t.Logf("got: %v", actual)
+		t.Error("reject callback was not called immediately")
+	}
+}
@@ -0,0 +1,255 @@
+package promise
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// Then returns a promise which is resolved with the result of fn applied to
+// the value of p. fn is executed on the DefaultRunner once p is resolved. If
+// p is rejected, then returned promise is rejected with the same error and fn
+// is never called.
+func Then[T, U any](p *Promise[T], fn func(T) (U, error)) *Promise[U] {
+	return ThenOnRunner(defaultRunner(), p, fn)
+}
+
+// ThenOnRunner is the same as Then, but fn is executed on the runner r.
+func ThenOnRunner[T, U any](r *Runner, p *Promise[T], fn func(T) (U, error)) *Promise[U] {
+	next := NewPromise[U]()
+	p.whenSettled(func() {
+		if p.err != nil {
+			next.Reject(p.err)
+			return
+		}
+		v := p.result
+		r.enqueueNoWait(newExecPromise(next, func() (U, error) {
+			return fn(v)
+		}))
+	})
+	return next
+}
+
+// Catch returns a promise which is resolved with the value of p, or, if p is
+// rejected, with the result of fn applied to the rejection error. fn is
+// executed on the DefaultRunner and only if p is rejected.
+func Catch[T any](p *Promise[T], fn func(error) (T, error)) *Promise[T] {
+	return CatchOnRunner(defaultRunner(), p, fn)
+}
+
+// CatchOnRunner is the same as Catch, but fn is executed on the runner r.
+func CatchOnRunner[T any](r *Runner, p *Promise[T], fn func(error) (T, error)) *Promise[T] {
+	return catchOnRunner(r, p, func(error) bool { return true }, fn)
+}
+
+// CatchIs is the same as Catch, but fn is called only if the rejection error
+// matches target according to errors.Is. Any other rejection is propagated to
+// the returned promise untouched.
+func CatchIs[T any](p *Promise[T], target error, fn func(error) (T, error)) *Promise[T] {
+	return CatchIsOnRunner(defaultRunner(), p, target, fn)
+}
+
+// CatchIsOnRunner is the same as CatchIs, but fn is executed on the runner r.
+func CatchIsOnRunner[T any](r *Runner, p *Promise[T], target error, fn func(error) (T, error)) *Promise[T] {
+	return catchOnRunner(r, p, func(err error) bool { return errors.Is(err, target) }, fn)
+}
+
+func catchOnRunner[T any](r *Runner, p *Promise[T], match func(error) bool, fn func(error) (T, error)) *Promise[T] {
+	next := NewPromise[T]()
+	p.whenSettled(func() {
+		err := p.err
+		if err == nil {
+			next.Resolve(p.result)
+			return
+		}
+		if !match(err) {
+			next.Reject(err)
+			return
+		}
+		r.enqueueNoWait(newExecPromise(next, func() (T, error) {
+			return fn(err)
+		}))
+	})
+	return next
+}
+
+// All returns a promise which is resolved with the values of all promises ps
+// in the same order once all of them are resolved. The returned promise is
+// rejected as soon as any of ps is rejected, with the error of that promise.
+// All does not reject the rest of ps in this case, see AllOrReject.
+func All[T any](ps ...*Promise[T]) *Promise[[]T] {
+	return all(nil, ps)
+}
+
+// AllOrReject is the same as All, but once any of ps is rejected it also
+// rejects all the rest of ps with cause. If cause is nil, then ErrCanceled is
+// used.
+func AllOrReject[T any](cause error, ps ...*Promise[T]) *Promise[[]T] {
+	if cause == nil {
+		cause = ErrCanceled
+	}
+	return all(cause, ps)
+}
+
+func all[T any](cause error, ps []*Promise[T]) *Promise[[]T] {
+	next := NewPromise[[]T]()
+	if len(ps) == 0 {
+		next.Resolve([]T{})
+		return next
+	}
+
+	var mu sync.Mutex
+	values := make([]T, len(ps))
+	pending := len(ps)
+	rejected := false
+	for i, p := range ps {
+		p.whenSettled(func() {
+			if p.err != nil {
+				// only the first rejection rejects the rest of ps, as
+				// they end up here as well
+				mu.Lock()
+				first := !rejected
+				rejected = true
+				mu.Unlock()
+				if first {
+					next.Reject(p.err)
+					if cause != nil {
+						RejectAll(cause, ps)
+					}
+				}
+				return
+			}
+
+			mu.Lock()
+			values[i] = p.result
+			pending--
+			done := pending == 0
+			mu.Unlock()
+			if done {
+				next.Resolve(values)
+			}
+		})
+	}
+	return next
+}
+
+// Status of the settled promise
+type Status int
+
+const (
+	Resolved Status = iota + 1
+	Rejected
+)
+
+func (s Status) String() string {
+	switch s {
+	case Resolved:
+		return "resolved"
+	case Rejected:
+		return "rejected"
+	default:
+		return "unknown"
+	}
+}
+
+// Settled is the outcome of a settled promise
+type Settled[T any] struct {
+	Value  T
+	Err    error
+	Status Status
+}
+
+// AllSettled returns a promise which is resolved once all promises ps are
+// either resolved or rejected, with the outcomes of ps in the same order. The
+// returned promise is never rejected.
+func AllSettled[T any](ps ...*Promise[T]) *Promise[[]Settled[T]] {
+	next := NewPromise[[]Settled[T]]()
+	if len(ps) == 0 {
+		next.Resolve([]Settled[T]{})
+		return next
+	}
+
+	var mu sync.Mutex
+	outcomes := make([]Settled[T], len(ps))
+	pending := len(ps)
+	for i, p := range ps {
+		p.whenSettled(func() {
+			mu.Lock()
+			outcomes[i] = p.settled()
+			pending--
+			done := pending == 0
+			mu.Unlock()
+			if done {
+				next.Resolve(outcomes)
+			}
+		})
+	}
+	return next
+}
+
+// AggregateError is the error of a promise which depends on several
+// promises, all of which were rejected.
+type AggregateError struct {
+	Errors []error
+}
+
+func (e *AggregateError) Error() string {
+	if len(e.Errors) == 0 {
+		return "all promises were rejected"
+	}
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "all promises were rejected: " + strings.Join(msgs, "; ")
+}
+
+func (e *AggregateError) Unwrap() []error {
+	return e.Errors
+}
+
+// Any returns a promise which is resolved with the value of the first of ps
+// to be resolved. If all of ps are rejected, then the returned promise is
+// rejected with *AggregateError holding the errors of ps in the same order.
+// Any of no promises is rejected immediately.
+func Any[T any](ps ...*Promise[T]) *Promise[T] {
+	next := NewPromise[T]()
+	if len(ps) == 0 {
+		next.Reject(&AggregateError{})
+		return next
+	}
+
+	var mu sync.Mutex
+	errs := make([]error, len(ps))
+	pending := len(ps)
+	for i, p := range ps {
+		p.whenSettled(func() {
+			if p.err == nil {
+				next.Resolve(p.result)
+				return
+			}
+
+			mu.Lock()
+			errs[i] = p.err
+			pending--
+			done := pending == 0
+			mu.Unlock()
+			if done {
+				next.Reject(&AggregateError{Errors: errs})
+			}
+		})
+	}
+	return next
+}
+
+// Race returns a promise which is settled the same way as the first of ps to
+// be either resolved or rejected. Race of no promises is never settled.
+func Race[T any](ps ...*Promise[T]) *Promise[T] {
+	next := NewPromise[T]()
+	for _, p := range ps {
+		p.whenSettled(func() {
+			next.settle(p.result, p.err)
+		})
+	}
+	return next
+}
@@ -0,0 +1,351 @@
+package promise
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestThenResolvesWithContinuationResult(t *testing.T) {
+	r := NewRunner(DefaultRunnerConcurrency, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	p := AsyncOnRunner(r, func() (int, error) {
+		return 42, nil
+	})
+	next := ThenOnRunner(r, p, func(v int) (string, error) {
+		return strconv.Itoa(v), nil
+	})
+
+	actual, err := next.Result()
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if actual != "42" {
+		t.Logf("exp: %s", "42")
+		t.Logf("got: %s", actual)
+		t.Error("unexpected promise value")
+	}
+}
+
+func TestThenRejectsWithContinuationError(t *testing.T) {
+	r := NewRunner(DefaultRunnerConcurrency, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	expected := errors.New("hello world")
+	p := AsyncOnRunner(r, func() (int, error) {
+		return 42, nil
+	})
+	next := ThenOnRunner(r, p, func(v int) (string, error) {
+		return "", expected
+	})
+
+	_, err := next.Result()
+	if !errors.Is(err, expected) {
+		t.Logf("exp: %v", expected)
+		t.Logf("got: %v", err)
+		t.Error("unexpected promise error")
+	}
+}
+
+func TestThenPropagatesRejection(t *testing.T) {
+	r := NewRunner(DefaultRunnerConcurrency, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	expected := errors.New("hello world")
+	p := NewPromise[int]()
+	called := false
+	next := ThenOnRunner(r, p, func(v int) (string, error) {
+		called = true
+		return "", nil
+	})
+	p.Reject(expected)
+
+	_, err := next.Result()
+	if !errors.Is(err, expected) {
+		t.Logf("exp: %v", expected)
+		t.Logf("got: %v", err)
+		t.Error("unexpected promise error")
+	}
+	if called {
+		t.Error("continuation was called for rejected promise")
+	}
+}
+
+func TestCatchRecoversRejection(t *testing.T) {
+	r := NewRunner(DefaultRunnerConcurrency, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	p := AsyncOnRunner(r, func() (string, error) {
+		return "", errors.New("hello world")
+	})
+	next := CatchOnRunner(r, p, func(err error) (string, error) {
+		return "fallback", nil
+	})
+
+	actual, err := next.Result()
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if actual != "fallback" {
+		t.Logf("exp: %s", "fallback")
+		t.Logf("got: %s", actual)
+		t.Error("unexpected promise value")
+	}
+}
+
+func TestCatchPassesResolvedValue(t *testing.T) {
+	r := NewRunner(DefaultRunnerConcurrency, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	expected := "hello world"
+	p := AsyncOnRunner(r, func() (string, error) {
+		return expected, nil
+	})
+	next := CatchOnRunner(r, p, func(err error) (string, error) {
+		return "fallback", nil
+	})
+
+	actual, err := next.Result()
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if actual != expected {
+		t.Logf("exp: %s", expected)
+		t.Logf("got: %s", actual)
+		t.Error("unexpected promise value")
+	}
+}
+
+func TestCatchIsMatchesOnlyTargetError(t *testing.T) {
+	r := NewRunner(DefaultRunnerConcurrency, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	canceled := NewPromise[string]()
+	canceled.Cancel()
+	recovered, err := CatchIsOnRunner(r, canceled, ErrCanceled, func(err error) (string, error) {
+		return "canceled", nil
+	}).Result()
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if recovered != "canceled" {
+		t.Logf("exp: %s", "canceled")
+		t.Logf("got: %s", recovered)
+		t.Error("unexpected promise value")
+	}
+
+	expected := errors.New("hello world")
+	failed := NewPromise[string]()
+	failed.Reject(expected)
+	_, err = CatchIsOnRunner(r, failed, ErrCanceled, func(err error) (string, error) {
+		return "canceled", nil
+	}).Result()
+	if !errors.Is(err, expected) {
+		t.Logf("exp: %v", expected)
+		t.Logf("got: %v", err)
+		t.Error("unexpected promise error")
+	}
+}
+
+func TestAllResolvesInOrder(t *testing.T) {
+	ps := []*Promise[int]{
+		NewPromise[int](),
+		NewPromise[int](),
+		NewPromise[int](),
+	}
+	all := All(ps...)
+
+	ps[2].Resolve(3)
+	ps[0].Resolve(1)
+	ps[1].Resolve(2)
+
+	actual, err := all.Result()
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	expected := []int{1, 2, 3}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Logf("exp: %v", expected)
+			t.Logf("got: %v", actual)
+			t.Fatalf("unexpected promise value")
+		}
+	}
+}
+
+func TestAllFailsOnFirstRejection(t *testing.T) {
+	expected := errors.New("hello world")
+	ps := []*Promise[int]{
+		NewPromise[int](),
+		NewPromise[int](),
+	}
+	all := All(ps...)
+
+	// the first promise is never settled, but it should not
+	// stop All from being rejected by the second one.
+	ps[1].Reject(expected)
+
+	_, err := all.Result()
+	if !errors.Is(err, expected) {
+		t.Logf("exp: %v", expected)
+		t.Logf("got: %v", err)
+		t.Error("unexpected promise error")
+	}
+
+	select {
+	case <-ps[0].Done():
+		t.Error("All should not reject the rest of promises")
+	default:
+	}
+}
+
+func TestAllOrRejectRejectsTheRest(t *testing.T) {
+	cause := errors.New("sibling failed")
+	ps := []*Promise[int]{
+		NewPromise[int](),
+		NewPromise[int](),
+	}
+	all := AllOrReject(cause, ps...)
+
+	ps[1].Reject(errors.New("hello world"))
+
+	_, _ = all.Result()
+	_, err := ps[0].Result()
+	if !errors.Is(err, cause) {
+		t.Logf("exp: %v", cause)
+		t.Logf("got: %v", err)
+		t.Error("unexpected error of rejected sibling")
+	}
+}
+
+func TestAllOrRejectRejectsTheRestOnce(t *testing.T) {
+	// rejecting the rest of ps on every rejection takes quadratic time, so
+	// the test does not finish in time
+	ps := make([]*Promise[int], 20000)
+	for i := range ps {
+		ps[i] = NewPromise[int]()
+	}
+	all := AllOrReject(nil, ps...)
+
+	start := time.Now()
+	ps[0].Reject(errors.New("hello world"))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("rejecting the rest of promises took %v", elapsed)
+	}
+
+	_, _ = all.Result()
+	for i, p := range ps[1:] {
+		if !p.Canceled() {
+			t.Fatalf("promise %d is not canceled", i+1)
+		}
+	}
+}
+
+func TestAllOfNothingIsResolved(t *testing.T) {
+	actual, err := All[int]().Result()
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if len(actual) != 0 {
+		t.Errorf("unexpected promise value: %v", actual)
+	}
+}
+
+func TestAllSettledReportsEveryOutcome(t *testing.T) {
+	expected := errors.New("hello world")
+	ps := []*Promise[int]{
+		NewPromise[int](),
+		NewPromise[int](),
+		NewPromise[int](),
+	}
+	all := AllSettled(ps...)
+
+	ps[1].Reject(expected)
+	ps[0].Resolve(1)
+	ps[2].Cancel()
+
+	actual, err := all.Result()
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if len(actual) != len(ps) {
+		t.Fatalf("unexpected number of outcomes: %d", len(actual))
+	}
+	if actual[0].Status != Resolved || actual[0].Value != 1 || actual[0].Err != nil {
+		t.Errorf("unexpected outcome of resolved promise: %+v", actual[0])
+	}
+	if actual[1].Status != Rejected || !errors.Is(actual[1].Err, expected) {
+		t.Errorf("unexpected outcome of rejected promise: %+v", actual[1])
+	}
+	if actual[2].Status != Rejected || !errors.Is(actual[2].Err, ErrCanceled) {
+		t.Errorf("unexpected outcome of canceled promise: %+v", actual[2])
+	}
+}
+
+func TestAnyResolvesWithFirstSuccess(t *testing.T) {
+	ps := []*Promise[int]{
+		NewPromise[int](),
+		NewPromise[int](),
+		NewPromise[int](),
+	}
+	first := Any(ps...)
+
+	ps[1].Reject(errors.New("hello world"))
+	ps[2].Resolve(3)
+
+	actual, err := first.Result()
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if actual != 3 {
+		t.Logf("exp: %d", 3)
+		t.Logf("got: %d", actual)
+		t.Error("unexpected promise value")
+	}
+}
+
+func TestAnyAggregatesErrors(t *testing.T) {
+	err1 := errors.New("hello")
+	err2 := errors.New("world")
+	ps := []*Promise[int]{
+		NewPromise[int](),
+		NewPromise[int](),
+	}
+	first := Any(ps...)
+
+	ps[1].Reject(err2)
+	ps[0].Reject(err1)
+
+	_, err := first.Result()
+	var aggregate *AggregateError
+	if !errors.As(err, &aggregate) {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if !errors.Is(err, err1) || !errors.Is(err, err2) {
+		t.Errorf("aggregate error does not wrap all errors: %v", err)
+	}
+	if aggregate.Errors[0] != err1 || aggregate.Errors[1] != err2 {
+		t.Errorf("unexpected order of aggregated errors: %v", aggregate.Errors)
+	}
+}
+
+func TestRaceSettlesWithFirstSettled(t *testing.T) {
+	expected := errors.New("hello world")
+	ps := []*Promise[int]{
+		NewPromise[int](),
+		NewPromise[int](),
+	}
+	race := Race(ps...)
+
+	ps[1].Reject(expected)
+	ps[0].Resolve(1)
+
+	_, err := race.Result()
+	if !errors.Is(err, expected) {
+		t.Logf("exp: %v", expected)
+		t.Logf("got: %v", err)
+		t.Error("unexpected promise error")
+	}
+}
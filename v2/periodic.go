@@ -0,0 +1,149 @@
+package promise
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"time"
+)
+
+// Periodic is a handle of impl executed periodically by Every or
+// EveryWithDelay
+type Periodic[T any] struct {
+	results chan Settled[T]
+	cancel  context.CancelCauseFunc
+	done    chan struct{}
+}
+
+// Every executes impl on the runner r at a fixed rate, i.e. every interval
+// starting from the moment of the call. Executions never overlap: if one
+// takes longer than interval (or its outcome is not consumed in time), then
+// the missed ticks are skipped and the next execution starts at the next tick.
+// If the execution exceeds its timeout (see WithTimeout), then its outcome is
+// reported immediately, but the next execution does not start until the
+// timed out one returns.
+//
+// The outcome of each execution is available via Results or All. Periodic
+// execution continues until ctx is done, Stop is called or r is shut down
+// (e.g. with Wait). The context passed to impl is canceled in the same way as
+// for AsyncOnRunnerCtx and once periodic execution is stopped.
+//
+// Every panics if interval is not positive.
+func Every[T any](ctx context.Context, r *Runner, interval time.Duration, impl func(context.Context) (T, error), opts ...TaskOption) *Periodic[T] {
+	if interval <= 0 {
+		panic(errors.New("non-positive interval for Every"))
+	}
+	return startPeriodic(ctx, r, func(at time.Time) time.Time {
+		at = at.Add(interval)
+		if late := time.Since(at); late > 0 {
+			// skip missed ticks
+			at = at.Add((late/interval + 1) * interval)
+		}
+		return at
+	}, impl, opts)
+}
+
+// EveryWithDelay is the same as Every, but executes impl with a fixed delay,
+// i.e. the next execution starts once delay elapses after the previous
+// outcome is consumed.
+//
+// EveryWithDelay panics if delay is not positive.
+func EveryWithDelay[T any](ctx context.Context, r *Runner, delay time.Duration, impl func(context.Context) (T, error), opts ...TaskOption) *Periodic[T] {
+	if delay <= 0 {
+		panic(errors.New("non-positive delay for EveryWithDelay"))
+	}
+	return startPeriodic(ctx, r, func(time.Time) time.Time {
+		return time.Now().Add(delay)
+	}, impl, opts)
+}
+
+func startPeriodic[T any](ctx context.Context, r *Runner, next func(time.Time) time.Time, impl func(context.Context) (T, error), opts []TaskOption) *Periodic[T] {
+	ctx, cancel := context.WithCancelCause(ctx)
+	p := &Periodic[T]{
+		results: make(chan Settled[T]),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go p.loop(ctx, r, next, impl, opts)
+	return p
+}
+
+func (p *Periodic[T]) loop(ctx context.Context, r *Runner, next func(time.Time) time.Time, impl func(context.Context) (T, error), opts []TaskOption) {
+	defer close(p.done)
+	defer close(p.results)
+
+	at := time.Now()
+	for {
+		at = next(at)
+		promise := NewPromise[T]()
+		_, item := newExecPromiseCtx(ctx, promise, impl)
+		item = item.with(opts)
+		promise.whenSettled(r.schedule(time.Until(at), item))
+
+		select {
+		case <-promise.Done():
+		case <-ctx.Done():
+			promise.Reject(context.Cause(ctx))
+			return
+		}
+		if errors.Is(promise.err, ErrExecutionDone) {
+			// runner is shut down
+			return
+		}
+
+		// runner context is canceled once the runner is shut down, so
+		// periodic execution stops even if outcomes are not consumed
+		shutdown := r.context().Done()
+		select {
+		case p.results <- promise.settled():
+		case <-ctx.Done():
+			return
+		case <-shutdown:
+			return
+		}
+
+		if freed := item.timedOut(promise.err); freed != nil {
+			// wait for the timed out execution to return, so
+			// executions never overlap
+			select {
+			case <-freed:
+			case <-ctx.Done():
+				return
+			case <-shutdown:
+				return
+			}
+		}
+	}
+}
+
+// Results returns the channel of execution outcomes. The channel is closed
+// once periodic execution is stopped.
+func (p *Periodic[T]) Results() <-chan Settled[T] {
+	return p.results
+}
+
+// All returns an iterator over execution outcomes. Periodic execution is
+// stopped if the loop over the iterator is terminated early.
+func (p *Periodic[T]) All() iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for outcome := range p.results {
+			if !yield(outcome.Value, outcome.Err) {
+				p.Stop()
+				return
+			}
+		}
+	}
+}
+
+// Stop stops periodic execution. Pending execution is not started anymore,
+// while the context of the running one is canceled with ErrCanceled as the
+// cause. Stop returns once Results channel is closed.
+func (p *Periodic[T]) Stop() {
+	p.cancel(ErrCanceled)
+	<-p.done
+}
+
+// Done returns the channel which is closed once periodic execution is stopped
+func (p *Periodic[T]) Done() <-chan struct{} {
+	return p.done
+}
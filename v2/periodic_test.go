@@ -0,0 +1,196 @@
+package promise
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEveryExecutesPeriodically(t *testing.T) {
+	r := NewRunner(2, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	var runs atomic.Int32
+	p := Every(context.Background(), r, 5*time.Millisecond, func(context.Context) (int32, error) {
+		return runs.Add(1), nil
+	})
+
+	for i := int32(1); i <= 3; i++ {
+		outcome := <-p.Results()
+		if outcome.Err != nil || outcome.Value != i {
+			t.Logf("exp: %v", i)
+			t.Logf("got: %v %v", outcome.Value, outcome.Err)
+			t.Error("unexpected outcome")
+		}
+	}
+
+	p.Stop()
+	if _, ok := <-p.Results(); ok {
+		t.Errorf("results channel is not closed after Stop")
+	}
+}
+
+func TestEveryNeverOverlaps(t *testing.T) {
+	r := NewRunner(4, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	var running, overlaps atomic.Int32
+	p := Every(context.Background(), r, time.Millisecond, func(context.Context) (string, error) {
+		if running.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		defer running.Add(-1)
+		time.Sleep(5 * time.Millisecond)
+		return "", nil
+	})
+
+	for i := 0; i < 5; i++ {
+		<-p.Results()
+	}
+	p.Stop()
+
+	if n := overlaps.Load(); n != 0 {
+		t.Errorf("periodic executions overlapped %d times", n)
+	}
+}
+
+func TestEveryWithDelayWaitsBetweenExecutions(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	delay := 10 * time.Millisecond
+	p := EveryWithDelay(context.Background(), r, delay, func(context.Context) (time.Time, error) {
+		time.Sleep(5 * time.Millisecond)
+		return time.Now(), nil
+	})
+
+	prev := (<-p.Results()).Value
+	for i := 0; i < 3; i++ {
+		next := (<-p.Results()).Value
+		// each execution sleeps before it returns the time
+		if gap := next.Sub(prev); gap < delay+5*time.Millisecond {
+			t.Errorf("executions are %v apart", gap)
+		}
+		prev = next
+	}
+	p.Stop()
+}
+
+func TestEveryIsStoppedByContext(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Every(ctx, r, time.Hour, func(context.Context) (string, error) {
+		return "", nil
+	})
+	cancel()
+
+	select {
+	case <-p.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("periodic execution is not stopped")
+	}
+
+	r.mu.Lock()
+	delayed := len(r.delayed)
+	r.mu.Unlock()
+	if delayed != 0 {
+		t.Errorf("stopped periodic execution is still scheduled")
+	}
+}
+
+func TestEveryIsStoppedByRunnerWait(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+
+	p := Every(context.Background(), r, time.Hour, func(context.Context) (string, error) {
+		return "", nil
+	})
+	r.Wait()
+
+	select {
+	case <-p.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("periodic execution is not stopped")
+	}
+}
+
+func TestEveryAllStopsOnBreak(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	expErr := errors.New("poll failed")
+	p := Every(context.Background(), r, time.Millisecond, func(context.Context) (int, error) {
+		return 0, expErr
+	})
+
+	n := 0
+	for _, err := range p.All() {
+		if !errors.Is(err, expErr) {
+			t.Logf("exp: %v", expErr)
+			t.Logf("got: %v", err)
+			t.Error("unexpected error")
+		}
+		if n++; n == 3 {
+			break
+		}
+	}
+
+	select {
+	case <-p.Done():
+	default:
+		t.Errorf("periodic execution is not stopped after break")
+	}
+}
+
+func TestEveryWithTimeoutNeverOverlaps(t *testing.T) {
+	r := NewRunner(4, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	var running, overlaps atomic.Int32
+	p := Every(context.Background(), r, time.Millisecond, func(context.Context) (string, error) {
+		if running.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		defer running.Add(-1)
+		// ignore cancelation of the context
+		time.Sleep(30 * time.Millisecond)
+		return "", nil
+	}, WithTimeout(5*time.Millisecond))
+
+	for i := 0; i < 3; i++ {
+		outcome := <-p.Results()
+		var timeoutErr *TimeoutError
+		if !errors.As(outcome.Err, &timeoutErr) {
+			t.Fatalf("unexpected error %[1]v (%[1]T)", outcome.Err)
+		}
+	}
+	p.Stop()
+
+	if n := overlaps.Load(); n != 0 {
+		t.Errorf("periodic executions overlapped %d times", n)
+	}
+}
+
+func TestEveryIsStoppedByRunnerWaitWithoutConsumer(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+
+	var runs atomic.Int32
+	p := Every(context.Background(), r, time.Millisecond, func(context.Context) (string, error) {
+		runs.Add(1)
+		return "", nil
+	})
+	// outcome of the first execution is never consumed
+	for runs.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	r.Wait()
+
+	select {
+	case <-p.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("periodic execution is not stopped")
+	}
+}
@@ -1,25 +1,29 @@
 package promise
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 )
 
-const (
-	DefaultRunnerConcurrency = 4
-	DefaultRunnerCapacity    = 100
-)
-
 var (
 	ErrCanceled      = errors.New("promise canceled")
 	ErrExecutionDone = errors.New("execution is done")
+	ErrRunnerFull    = errors.New("runner is full")
+	// ErrWaitAborted is returned by ResultContext and ResultTimeout if the
+	// caller gave up waiting before the promise was settled. The promise
+	// itself is not affected by this.
+	ErrWaitAborted = errors.New("waiting for promise result aborted")
 )
 
 type Promise[T any] struct {
-	done   chan struct{}
-	result T
-	err    error
+	mu        sync.Mutex
+	done      chan struct{}
+	result    T
+	err       error
+	callbacks []func()
 }
 
 func NewPromise[T any]() *Promise[T] {
@@ -40,7 +44,44 @@ func (p *Promise[T]) Result() (T, error) {
 	return p.result, p.err
 }
 
-// Cancel cancel the promise, by failing it with ErrCanceled
+// ResultContext returns result of the undelying promise. This method blocks
+// until either promise is settled or ctx is done. In the latter case it
+// returns an error which matches both ErrWaitAborted and the cause of ctx
+// cancelation, while the promise is left untouched.
+func (p *Promise[T]) ResultContext(ctx context.Context) (T, error) {
+	select {
+	case <-p.Done():
+		return p.result, p.err
+	case <-ctx.Done():
+		var zero T
+		return zero, fmt.Errorf("%w: %w", ErrWaitAborted, context.Cause(ctx))
+	}
+}
+
+// ResultTimeout is the same as ResultContext, but waits for at most d.
+func (p *Promise[T]) ResultTimeout(d time.Duration) (T, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return p.ResultContext(ctx)
+}
+
+// TryResult returns result of the undelying promise without blocking. The
+// last returned value is false if the promise is not settled yet.
+func (p *Promise[T]) TryResult() (T, error, bool) {
+	select {
+	case <-p.Done():
+		return p.result, p.err, true
+	default:
+		var zero T
+		return zero, nil, false
+	}
+}
+
+// Cancel cancel the promise, by failing it with ErrCanceled. If the promise
+// function is not started yet, then it is never executed. If the promise
+// function is already running and was started with AsyncCtx or
+// AsyncOnRunnerCtx, then its context is canceled with ErrCanceled as the
+// cause.
 func (p *Promise[T]) Cancel() {
 	p.Reject(ErrCanceled)
 }
@@ -57,150 +98,120 @@ func (p *Promise[T]) Canceled() bool {
 
 // Reject rejects the promise with err
 func (p *Promise[T]) Reject(err error) {
-	select {
-	case <-p.Done():
-		// if promise is already done, then its to late
-		return
-	default:
-		p.err = err
-		close(p.done)
-	}
+	var zero T
+	p.settle(zero, err)
 }
 
 // Resolve resolves the promise with v
 func (p *Promise[T]) Resolve(v T) {
+	p.settle(v, nil)
+}
+
+func (p *Promise[T]) settle(v T, err error) {
+	p.mu.Lock()
 	select {
 	case <-p.Done():
 		// if promise is already done, then its to late
+		p.mu.Unlock()
 		return
 	default:
-		p.result = v
-		close(p.done)
+	}
+	p.result = v
+	p.err = err
+	close(p.done)
+	callbacks := p.callbacks
+	p.callbacks = nil
+	p.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn()
 	}
 }
 
-type Rejectable interface {
-	Reject(error)
+// settled returns the outcome of the settled promise
+func (p *Promise[T]) settled() Settled[T] {
+	if p.err != nil {
+		return Settled[T]{Err: p.err, Status: Rejected}
+	}
+	return Settled[T]{Value: p.result, Status: Resolved}
 }
 
-// RejectAll rejects all promises
-func RejectAll[S []E, E Rejectable](err error, promises S) {
-	for i := range promises {
-		promises[i].Reject(err)
+// whenSettled calls fn once the promise is either resolved or rejected. If
+// promise is already settled, then fn is called immediately.
+func (p *Promise[T]) whenSettled(fn func()) {
+	p.mu.Lock()
+	select {
+	case <-p.Done():
+		p.mu.Unlock()
+		fn()
+	default:
+		p.callbacks = append(p.callbacks, fn)
+		p.mu.Unlock()
 	}
 }
 
-type execPromise struct {
-	promise Rejectable
-	exec    func()
+// OnResolve registers fn to be called with the value of the promise once it
+// is resolved. fn is never called if the promise is rejected.
+//
+// Callbacks are called in the order of registration on the goroutine which
+// settles the promise, after Done channel is closed. If the promise is already
+// settled, then fn is called immediately on the calling goroutine.
+func (p *Promise[T]) OnResolve(fn func(T)) {
+	p.whenSettled(func() {
+		if p.err == nil {
+			fn(p.result)
+		}
+	})
 }
 
-type Runner struct {
-	stoping  chan struct{}
-	promises chan execPromise
-	wg       sync.WaitGroup
+// OnReject registers fn to be called with the error of the promise once it is
+// rejected. fn is never called if the promise is resolved. See OnResolve for
+// the order in which callbacks are called.
+func (p *Promise[T]) OnReject(fn func(error)) {
+	p.whenSettled(func() {
+		if p.err != nil {
+			fn(p.err)
+		}
+	})
 }
 
-func NewRunner(conc int, capacity int) *Runner {
-	r := &Runner{
-		stoping:  make(chan struct{}),
-		promises: make(chan execPromise, capacity),
-		wg:       sync.WaitGroup{},
-	}
-	r.wg.Add(conc)
-	for i := 0; i < conc; i++ {
-		go func() {
-			defer r.wg.Done()
-			for {
-				select {
-				case <-r.stoping:
-					return
-				default:
-				}
-
-				select {
-				case <-r.stoping:
-					return
-				case promise := <-r.promises:
-					promise.exec()
-				}
-			}
-		}()
-	}
-
-	return r
+// Finally registers fn to be called once the promise is either resolved or
+// rejected. See OnResolve for the order in which callbacks are called.
+func (p *Promise[T]) Finally(fn func()) {
+	p.whenSettled(fn)
 }
 
-// Wait executes all pending promises and stops
-// execution of all further promises
-func (r *Runner) Wait() {
-	select {
-	case <-r.stoping:
-		return
-	default:
-		close(r.stoping)
-	}
-	r.wg.Wait()
-
-	// wait for at most 1ms to finish all pending Async calls
-	// which are already writting to promises channel.
-	closed := make(chan struct{})
-	go func() {
-		defer close(closed)
-		defer close(r.promises)
-		for {
-			select {
-			case item := <-r.promises:
-				item.exec()
-			case <-time.After(time.Millisecond):
-				return
-			}
-		}
-	}()
-	<-closed
-	for item := range r.promises {
-		item.exec()
-	}
+// OnResolveOnRunner is the same as OnResolve, but fn is executed on the
+// runner r. If r is not accepting promises anymore, then fn is called inline.
+func (p *Promise[T]) OnResolveOnRunner(r *Runner, fn func(T)) {
+	p.OnResolve(func(v T) {
+		r.dispatch(func() { fn(v) })
+	})
 }
 
-var DefaultRunner = NewRunner(DefaultRunnerConcurrency, DefaultRunnerCapacity)
-
-func Async[T any](impl func() (T, error)) *Promise[T] {
-	return AsyncOnRunner(DefaultRunner, impl)
+// OnRejectOnRunner is the same as OnReject, but fn is executed on the runner
+// r. If r is not accepting promises anymore, then fn is called inline.
+func (p *Promise[T]) OnRejectOnRunner(r *Runner, fn func(error)) {
+	p.OnReject(func(err error) {
+		r.dispatch(func() { fn(err) })
+	})
 }
 
-func Wait() {
-	DefaultRunner.Wait()
+// FinallyOnRunner is the same as Finally, but fn is executed on the runner r.
+// If r is not accepting promises anymore, then fn is called inline.
+func (p *Promise[T]) FinallyOnRunner(r *Runner, fn func()) {
+	p.Finally(func() {
+		r.dispatch(fn)
+	})
 }
 
-func AsyncOnRunner[T any](r *Runner, impl func() (T, error)) *Promise[T] {
-	promise := NewPromise[T]()
-	item := execPromise{
-		promise: promise,
-		exec: func() {
-			result, err := impl()
-			if err != nil {
-				promise.Reject(err)
-			} else {
-				promise.Resolve(result)
-			}
-		},
-	}
-
-	// select picks channel randomly, so prioritize r.done
-	// channel to avoid writing to the closed promise channel
-	select {
-	case <-r.stoping:
-		promise.Reject(ErrExecutionDone)
-		return promise
-	default:
-	}
+type Rejectable interface {
+	Reject(error)
+}
 
-	select {
-	case <-r.stoping:
-		promise.Reject(ErrExecutionDone)
-	case r.promises <- item:
+// RejectAll rejects all promises
+func RejectAll[S []E, E Rejectable](err error, promises S) {
+	for i := range promises {
+		promises[i].Reject(err)
 	}
-
-	return promise
 }
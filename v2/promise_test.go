@@ -1,6 +1,7 @@
 package promise
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -141,7 +142,7 @@ func TestRunnerResolvesPromises(t *testing.T) {
 	t.Cleanup(r.Wait)
 
 	expected := "hello world"
-	p := Async(r, func() (string, error) {
+	p := AsyncOnRunner(r, func() (string, error) {
 		return expected, nil
 	})
 
@@ -162,7 +163,7 @@ func TestRunnerRejectsPromises(t *testing.T) {
 	t.Cleanup(r.Wait)
 
 	expected := errors.New("hello world")
-	p := Async(r, func() (string, error) {
+	p := AsyncOnRunner(r, func() (string, error) {
 		return "", expected
 	})
 
@@ -209,13 +210,13 @@ func TestRunnerExecutesAllPendingPromises(t *testing.T) {
 	r := NewRunner(1, DefaultRunnerCapacity)
 
 	// make some promise for long runnig function
-	_ = Async(r, func() (string, error) {
+	_ = AsyncOnRunner(r, func() (string, error) {
 		time.Sleep(100 * time.Millisecond)
 		return "", nil
 	})
 
 	expected := "hello world"
-	p := Async(r, func() (string, error) {
+	p := AsyncOnRunner(r, func() (string, error) {
 		return expected, nil
 	})
 	r.Wait()
@@ -231,7 +232,7 @@ func TestRunnerExecutesAllPendingPromises(t *testing.T) {
 		t.Error("unexpected promise value")
 	}
 
-	shouldReject := Async(r, func() (string, error) {
+	shouldReject := AsyncOnRunner(r, func() (string, error) {
 		return "", nil
 	})
 	_, err = shouldReject.Result()
@@ -245,3 +246,451 @@ func TestRunnerExecutesAllPendingPromises(t *testing.T) {
 	}
 
 }
+
+func TestPromiseCallbacksAreCalledInRegistrationOrder(t *testing.T) {
+	p := NewPromise[string]()
+
+	var calls []string
+	p.OnResolve(func(v string) {
+		calls = append(calls, "resolve:"+v)
+	})
+	p.OnReject(func(err error) {
+		calls = append(calls, "reject")
+	})
+	p.Finally(func() {
+		calls = append(calls, "finally")
+	})
+
+	p.Resolve("hello")
+	p.Resolve("world")
+
+	expected := []string{"resolve:hello", "finally"}
+	if len(calls) != len(expected) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Logf("exp: %v", expected)
+			t.Logf("got: %v", calls)
+			t.Fatalf("unexpected calls order")
+		}
+	}
+}
+
+func TestPromiseCallbacksOnSettledPromise(t *testing.T) {
+	expected := errors.New("hello world")
+	p := NewPromise[string]()
+	p.Reject(expected)
+
+	var actual error
+	p.OnResolve(func(string) {
+		t.Error("resolve callback called for rejected promise")
+	})
+	p.OnReject(func(err error) {
+		actual = err
+	})
+
+	if !errors.Is(actual, expected) {
+		t.Logf("exp: %v", expected)
+		t.Logf("got: %v", actual)
+		t.Error("reject callback was not called immediately")
+	}
+}
+
+func TestPromiseCallbacksOnRunner(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	p := NewPromise[string]()
+	called := make(chan string, 1)
+	p.OnResolveOnRunner(r, func(v string) {
+		called <- v
+	})
+	p.Resolve("hello world")
+
+	select {
+	case v := <-called:
+		if v != "hello world" {
+			t.Logf("exp: %s", "hello world")
+			t.Logf("got: %s", v)
+			t.Error("unexpected callback value")
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("callback was not called on runner")
+	}
+}
+
+func TestPromiseCallbacksOnWaitedRunnerAreCalledInline(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	r.Wait()
+
+	p := NewPromise[string]()
+	called := false
+	p.FinallyOnRunner(r, func() {
+		called = true
+	})
+	p.Resolve("hello world")
+
+	if !called {
+		t.Error("callback was not called inline")
+	}
+}
+
+func TestRunnerRecoversPanics(t *testing.T) {
+	panics := make(chan *PanicError, 1)
+	r := NewRunner(1, DefaultRunnerCapacity, WithPanicHandler(func(err *PanicError) {
+		panics <- err
+	}))
+	t.Cleanup(r.Wait)
+
+	p := AsyncOnRunner(r, func() (string, error) {
+		panic("hello world")
+	})
+
+	_, err := p.Result()
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if panicErr.Value != "hello world" {
+		t.Logf("exp: %v", "hello world")
+		t.Logf("got: %v", panicErr.Value)
+		t.Error("unexpected panic value")
+	}
+	if len(panicErr.Stack) == 0 {
+		t.Error("panic error has no stack trace")
+	}
+
+	select {
+	case notified := <-panics:
+		if notified != panicErr {
+			t.Error("panic handler got unexpected error")
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("panic handler was not called")
+	}
+
+	// the only worker of the runner should survive the panic
+	expected := "hello world"
+	actual, err := AsyncOnRunner(r, func() (string, error) {
+		return expected, nil
+	}).Result()
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if expected != actual {
+		t.Logf("exp: %s", expected)
+		t.Logf("got: %s", actual)
+		t.Error("unexpected promise value")
+	}
+}
+
+func TestAsyncCtxCancelsTaskContextWithCallerContext(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	p := AsyncOnRunnerCtx(ctx, r, func(ctx context.Context) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	<-started
+	cancel()
+
+	_, err := p.Result()
+	if !errors.Is(err, context.Canceled) {
+		t.Logf("exp: %v", context.Canceled)
+		t.Logf("got: %v", err)
+		t.Error("unexpected promise error")
+	}
+}
+
+func TestAsyncCtxCancelsTaskContextWithPromise(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	started := make(chan struct{})
+	finished := make(chan error)
+	p := AsyncOnRunnerCtx(context.Background(), r, func(ctx context.Context) (string, error) {
+		close(started)
+		<-ctx.Done()
+		finished <- ctx.Err()
+		return "", ctx.Err()
+	})
+	<-started
+	p.Cancel()
+
+	select {
+	case err := <-finished:
+		if !errors.Is(err, context.Canceled) {
+			t.Logf("exp: %v", context.Canceled)
+			t.Logf("got: %v", err)
+			t.Error("unexpected task context error")
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("task context was not canceled with the promise")
+	}
+}
+
+func TestAsyncCtxCancelsTaskContextWithRunnerStop(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+
+	started := make(chan struct{})
+	p := AsyncOnRunnerCtx(context.Background(), r, func(ctx context.Context) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", context.Cause(ctx)
+	})
+	<-started
+	r.Stop()
+
+	_, err := p.ResultTimeout(time.Second)
+	if err != ErrExecutionDone {
+		t.Logf("exp: %v", ErrExecutionDone)
+		t.Logf("got: %v", err)
+		t.Error("unexpected cause of task context cancelation")
+	}
+}
+
+func TestAsyncCtxCancelsTaskContextWithRunnerShutdown(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+
+	started := make(chan struct{})
+	p := AsyncOnRunnerCtx(context.Background(), r, func(ctx context.Context) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", context.Cause(ctx)
+	})
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = r.Shutdown(ctx)
+
+	_, err := p.ResultTimeout(time.Second)
+	if err != ErrExecutionDone {
+		t.Logf("exp: %v", ErrExecutionDone)
+		t.Logf("got: %v", err)
+		t.Error("unexpected cause of task context cancelation")
+	}
+}
+
+func TestRunnerDoesNotExecuteCanceledPromises(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	release := make(chan struct{})
+	_ = AsyncOnRunner(r, func() (string, error) {
+		<-release
+		return "", nil
+	})
+
+	executed := make(chan struct{}, 1)
+	p := AsyncOnRunner(r, func() (string, error) {
+		executed <- struct{}{}
+		return "", nil
+	})
+	p.Cancel()
+	close(release)
+
+	done := AsyncOnRunner(r, func() (string, error) {
+		return "", nil
+	})
+	_, _ = done.Result()
+
+	select {
+	case <-executed:
+		t.Error("canceled promise was executed")
+	default:
+	}
+}
+
+func TestPromiseCancelPropagatesIntoTaskContext(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	started := make(chan struct{})
+	cause := make(chan error, 1)
+	p := AsyncOnRunnerCtx(context.Background(), r, func(ctx context.Context) (string, error) {
+		close(started)
+		<-ctx.Done()
+		cause <- context.Cause(ctx)
+		return "", ctx.Err()
+	})
+	<-started
+	p.Cancel()
+
+	select {
+	case err := <-cause:
+		if !errors.Is(err, ErrCanceled) {
+			t.Logf("exp: %v", ErrCanceled)
+			t.Logf("got: %v", err)
+			t.Error("unexpected cause of task context cancelation")
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("task context was not canceled")
+	}
+}
+
+func TestPromiseResultContextIfContextCanceled(t *testing.T) {
+	p := NewPromise[string]()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	_, err := p.ResultContext(ctx)
+	if !errors.Is(err, ErrWaitAborted) {
+		t.Logf("exp: %v", ErrWaitAborted)
+		t.Logf("got: %v", err)
+		t.Fatalf("unexpected error")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Logf("exp: %v", context.DeadlineExceeded)
+		t.Logf("got: %v", err)
+		t.Fatalf("unexpected error")
+	}
+
+	select {
+	case <-p.Done():
+		t.Fatalf("promise is done after the caller gave up")
+	default:
+	}
+}
+
+func TestPromiseResultTimeoutIfPromiseIsRejected(t *testing.T) {
+	expected := errors.New("hello world")
+	p := NewPromise[string]()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		p.Reject(expected)
+	}()
+
+	_, err := p.ResultTimeout(time.Second)
+	if !errors.Is(err, expected) {
+		t.Logf("exp: %v", expected)
+		t.Logf("got: %v", err)
+		t.Fatalf("unexpected error")
+	}
+	if errors.Is(err, ErrWaitAborted) {
+		t.Fatalf("rejected promise reported as aborted wait")
+	}
+}
+
+func TestPromiseTryResult(t *testing.T) {
+	p := NewPromise[string]()
+
+	if _, _, ok := p.TryResult(); ok {
+		t.Fatalf("promise is settled after creation")
+	}
+
+	expected := "hello world"
+	p.Resolve(expected)
+
+	actual, err, ok := p.TryResult()
+	if !ok {
+		t.Fatalf("promise is not settled after being resolved")
+	}
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if actual != expected {
+		t.Logf("exp: %s", expected)
+		t.Logf("got: %s", actual)
+		t.Error("unexpected promise value")
+	}
+}
+
+func TestRunnerShutdownExecutesQueuedPromises(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+
+	ps := make([]*Promise[int], 10)
+	for i := range ps {
+		ps[i] = AsyncOnRunner(r, func() (int, error) {
+			return i, nil
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := r.Shutdown(ctx); err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+
+	for i := range ps {
+		if _, err, ok := ps[i].TryResult(); !ok || err != nil {
+			t.Errorf("promise %d is not executed by shutdown: %v", i, err)
+		}
+	}
+}
+
+func TestRunnerShutdownDoesNotDropQueuedCallbacks(t *testing.T) {
+	// runner without workers never dequeues promises
+	r := NewRunner(0, DefaultRunnerCapacity)
+
+	p := NewPromise[int]()
+	called := false
+	p.FinallyOnRunner(r, func() {
+		called = true
+	})
+	p.Resolve(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.Shutdown(ctx); err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if !called {
+		t.Error("queued callback was not called by shutdown")
+	}
+}
+
+func TestRunnerShutdownDropsQueuedPromisesAfterDeadline(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+
+	running := AsyncOnRunnerCtx(context.Background(), r, func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	queued := make([]*Promise[int], 3)
+	for i := range queued {
+		queued[i] = AsyncOnRunner(r, func() (int, error) {
+			return i, nil
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := r.Shutdown(ctx)
+
+	var shutdownErr *ShutdownError
+	if !errors.As(err, &shutdownErr) {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("shutdown error does not wrap the context error: %v", err)
+	}
+	if shutdownErr.Dropped != len(queued) {
+		t.Logf("exp: %d", len(queued))
+		t.Logf("got: %d", shutdownErr.Dropped)
+		t.Error("unexpected number of dropped promises")
+	}
+
+	for i := range queued {
+		_, err := queued[i].Result()
+		if !errors.Is(err, ErrExecutionDone) {
+			t.Logf("exp: %v", ErrExecutionDone)
+			t.Logf("got: %v", err)
+			t.Error("unexpected error of dropped promise")
+		}
+	}
+
+	_, err = running.Result()
+	if !errors.Is(err, context.Canceled) {
+		t.Logf("exp: %v", context.Canceled)
+		t.Logf("got: %v", err)
+		t.Error("running promise context was not canceled")
+	}
+}
@@ -0,0 +1,97 @@
+package promise
+
+import (
+	"container/heap"
+	"time"
+)
+
+// DefaultPriorityAging is the time a queued promise waits to gain one
+// priority level.
+const DefaultPriorityAging = time.Second
+
+// taskQueue is the priority queue of promises waiting for execution. Queued
+// promise gains one priority level for each aging period it waits, so
+// promises with low priority are eventually executed even under the steady
+// flow of promises with high priority. Promises with the same effective
+// priority are executed in the order they were queued.
+type taskQueue struct {
+	items []queuedItem
+	aging time.Duration
+	seq   uint64
+}
+
+type queuedItem struct {
+	execPromise
+	seq uint64
+	// key is the time the promise would be queued with zero priority.
+	// The earlier is the key, the higher is the effective priority.
+	key time.Time
+}
+
+func (q *taskQueue) Len() int {
+	return len(q.items)
+}
+
+func (q *taskQueue) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+	if q.aging <= 0 {
+		// without aging priority is strict
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+	} else if !a.key.Equal(b.key) {
+		return a.key.Before(b.key)
+	}
+	return a.seq < b.seq
+}
+
+func (q *taskQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+}
+
+func (q *taskQueue) Push(x any) {
+	q.items = append(q.items, x.(queuedItem))
+}
+
+func (q *taskQueue) Pop() any {
+	last := len(q.items) - 1
+	item := q.items[last]
+	q.items[last] = queuedItem{}
+	q.items = q.items[:last]
+	return item
+}
+
+// push adds item to the queue
+func (q *taskQueue) push(item execPromise) {
+	q.seq++
+	heap.Push(q, queuedItem{
+		execPromise: item,
+		seq:         q.seq,
+		key:         time.Now().Add(-time.Duration(item.priority) * q.aging),
+	})
+}
+
+// pop removes the item with the highest effective priority from the queue
+func (q *taskQueue) pop() execPromise {
+	return heap.Pop(q).(queuedItem).execPromise
+}
+
+// popOldest removes the item which was queued first from the queue
+func (q *taskQueue) popOldest() execPromise {
+	oldest := 0
+	for i := range q.items {
+		if q.items[i].seq < q.items[oldest].seq {
+			oldest = i
+		}
+	}
+	return heap.Remove(q, oldest).(queuedItem).execPromise
+}
+
+// take removes all items from the queue in the order they were queued
+func (q *taskQueue) take() []execPromise {
+	items := make([]execPromise, 0, len(q.items))
+	for len(q.items) > 0 {
+		items = append(items, q.popOldest())
+	}
+	return items
+}
@@ -0,0 +1,69 @@
+package promise
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// executionOrder submits promises with given priorities to the runner without
+// workers, waits delay between submissions and then returns the order in
+// which a single worker executes them.
+func executionOrder(t *testing.T, r *Runner, delay time.Duration, priorities ...int) []int {
+	t.Helper()
+
+	var mu sync.Mutex
+	var order []int
+	ps := make([]*Promise[int], len(priorities))
+	for i, priority := range priorities {
+		ps[i] = AsyncWithPriority(r, priority, func() (int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, i)
+			return i, nil
+		})
+		time.Sleep(delay)
+	}
+
+	r.Resize(1)
+	if _, err := All(ps...).ResultTimeout(time.Second); err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	return order
+}
+
+func assertOrder(t *testing.T, expected, actual []int) {
+	t.Helper()
+	for i := range expected {
+		if len(actual) != len(expected) || actual[i] != expected[i] {
+			t.Logf("exp: %v", expected)
+			t.Logf("got: %v", actual)
+			t.Fatalf("unexpected execution order")
+		}
+	}
+}
+
+func TestRunnerExecutesHighestPriorityFirst(t *testing.T) {
+	r := NewRunner(0, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	order := executionOrder(t, r, 0, 0, 10, 5, 10)
+	assertOrder(t, []int{1, 3, 2, 0}, order)
+}
+
+func TestRunnerAgesQueuedPromises(t *testing.T) {
+	r := NewRunner(0, DefaultRunnerCapacity, WithPriorityAging(time.Millisecond))
+	t.Cleanup(r.Wait)
+
+	// low priority promise waits long enough to outrun the high priority one
+	order := executionOrder(t, r, 20*time.Millisecond, 0, 5)
+	assertOrder(t, []int{0, 1}, order)
+}
+
+func TestRunnerStrictPriorityWithoutAging(t *testing.T) {
+	r := NewRunner(0, DefaultRunnerCapacity, WithPriorityAging(0))
+	t.Cleanup(r.Wait)
+
+	order := executionOrder(t, r, 20*time.Millisecond, 0, 5)
+	assertOrder(t, []int{1, 0}, order)
+}
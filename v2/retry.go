@@ -0,0 +1,202 @@
+package promise
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRetryMultiplier is the backoff multiplier used if
+	// RetryPolicy.Multiplier is not set
+	DefaultRetryMultiplier = 2
+	// DefaultRetryMaxAttempts is the number of attempts used if
+	// RetryPolicy.MaxAttempts is not set
+	DefaultRetryMaxAttempts = 3
+	// MaxRetryErrors is the maximum number of attempt errors kept in
+	// RetryError if the number of attempts is not limited
+	MaxRetryErrors = 10
+)
+
+// RetryPolicy defines how AsyncRetry retries a failed task. The zero value
+// makes DefaultRetryMaxAttempts attempts without delays between them.
+type RetryPolicy struct {
+	// MaxAttempts limits the number of attempts, including the first one.
+	// DefaultRetryMaxAttempts is used if MaxAttempts is zero, while no limit
+	// is applied if MaxAttempts is negative.
+	MaxAttempts int
+	// MaxElapsed limits the time since the first attempt is submitted. A retry
+	// which would start later than that is not made. No limit is applied if
+	// MaxElapsed is not positive.
+	MaxElapsed time.Duration
+	// InitialBackoff is the delay before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts if positive
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after every retry. DefaultRetryMultiplier
+	// is used if Multiplier is zero.
+	Multiplier float64
+	// Jitter randomly shortens every delay by up to the given fraction of it,
+	// e.g. 0.5 makes delays vary between a half and the full delay. Jitter
+	// should be between 0 and 1.
+	Jitter float64
+	// Retryable decides whether the task failed with err should be retried.
+	// All errors are retryable if Retryable is nil. ErrExecutionDone is never
+	// retried, as it means the runner is shut down.
+	Retryable func(err error) bool
+}
+
+// backoff returns the delay before the retry following n failed attempts
+func (p RetryPolicy) backoff(n int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = DefaultRetryMultiplier
+	}
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(n-1))
+	if p.MaxBackoff > 0 {
+		d = min(d, float64(p.MaxBackoff))
+	}
+	if p.Jitter > 0 {
+		d -= d * min(p.Jitter, 1) * rand.Float64()
+	}
+	if d >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(d)
+}
+
+// retry returns the delay before the retry following n failed attempts, the
+// last of which failed with err. The last returned value is false if no retry
+// should be made.
+func (p RetryPolicy) retry(n int, elapsed time.Duration, err error) (time.Duration, bool) {
+	if errors.Is(err, ErrExecutionDone) {
+		return 0, false
+	}
+	if p.Retryable != nil && !p.Retryable(err) {
+		return 0, false
+	}
+	maxAttempts := p.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = DefaultRetryMaxAttempts
+	}
+	if maxAttempts > 0 && n >= maxAttempts {
+		return 0, false
+	}
+	d := p.backoff(n)
+	if p.MaxElapsed > 0 && elapsed+d > p.MaxElapsed {
+		return 0, false
+	}
+	return d, true
+}
+
+// RetryError is the error of a promise returned by AsyncRetry once it gives
+// up retrying.
+type RetryError struct {
+	// Attempts is the number of attempts made
+	Attempts int
+	// Errors of all attempts in the order they were made. If the number of
+	// attempts is not limited, then only the last MaxRetryErrors of them are
+	// kept.
+	Errors []error
+}
+
+func (e *RetryError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("all %d attempts failed: %s", e.Attempts, strings.Join(msgs, "; "))
+}
+
+func (e *RetryError) Unwrap() []error {
+	return e.Errors
+}
+
+// AsyncRetry schedules impl for execution on the runner r and retries it
+// according to policy as long as it fails. Delays between attempts are
+// handled the same way as by AsyncAfter, so waiting for a retry does not
+// occupy workers of r. If an attempt exceeds its timeout (see WithTimeout),
+// then the retry does not start until the timed out attempt returns.
+//
+// The returned promise is resolved with the value of the first successful
+// attempt or rejected with *RetryError holding errors of the attempts.
+// Canceling the promise stops further attempts.
+func AsyncRetry[T any](r *Runner, policy RetryPolicy, impl func() (T, error), opts ...TaskOption) *Promise[T] {
+	promise := NewPromise[T]()
+	start := time.Now()
+	attempts := 0
+	var errs []error
+
+	var mu sync.Mutex
+	var current *Promise[T]
+
+	var attempt func() (*Promise[T], execPromise)
+	attempt = func() (*Promise[T], execPromise) {
+		next := NewPromise[T]()
+		item := newExecPromise(next, impl).with(opts)
+		mu.Lock()
+		current = next
+		mu.Unlock()
+		if _, _, ok := promise.TryResult(); ok {
+			// promise was settled before current was updated
+			next.Reject(promise.err)
+		}
+
+		next.whenSettled(func() {
+			if next.err == nil {
+				promise.Resolve(next.result)
+				return
+			}
+			if _, _, ok := promise.TryResult(); ok {
+				return
+			}
+
+			// attempts never overlap, so attempts and errs are not
+			// accessed concurrently
+			attempts++
+			if policy.MaxAttempts < 0 && len(errs) == MaxRetryErrors {
+				errs = append(errs[:0], errs[1:]...)
+			}
+			errs = append(errs, next.err)
+			d, ok := policy.retry(attempts, time.Since(start), next.err)
+			if !ok {
+				promise.Reject(&RetryError{Attempts: attempts, Errors: errs})
+				return
+			}
+			retry := func() {
+				next, item := attempt()
+				next.whenSettled(r.schedule(d, item))
+			}
+			if freed := item.timedOut(next.err); freed != nil {
+				// wait for the timed out attempt to return, so
+				// attempts never overlap
+				go func() {
+					select {
+					case <-freed:
+						retry()
+					case <-promise.Done():
+					}
+				}()
+				return
+			}
+			retry()
+		})
+		return next, item
+	}
+
+	_, item := attempt()
+	promise.whenSettled(func() {
+		// stop the current attempt if it is not started yet
+		mu.Lock()
+		next := current
+		mu.Unlock()
+		next.Reject(promise.err)
+	})
+	r.enqueue(context.Background(), item)
+	return promise
+}
@@ -0,0 +1,311 @@
+package promise
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAsyncRetryResolvesAfterFailures(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	var attempts atomic.Int32
+	p := AsyncRetry(r, RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}, func() (int32, error) {
+		if n := attempts.Add(1); n < 3 {
+			return 0, fmt.Errorf("attempt %d failed", n)
+		}
+		return attempts.Load(), nil
+	})
+
+	res, err := p.ResultTimeout(time.Second)
+	if err != nil || res != 3 {
+		t.Logf("exp: 3 <nil>")
+		t.Logf("got: %v %v", res, err)
+		t.Error("unexpected result")
+	}
+}
+
+func TestAsyncRetryReportsAllErrors(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	expErrs := []error{errors.New("1"), errors.New("2"), errors.New("3")}
+	var attempts atomic.Int32
+	p := AsyncRetry(r, RetryPolicy{MaxAttempts: len(expErrs)}, func() (string, error) {
+		return "", expErrs[attempts.Add(1)-1]
+	})
+
+	_, err := p.ResultTimeout(time.Second)
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if len(retryErr.Errors) != len(expErrs) {
+		t.Logf("exp: %v", expErrs)
+		t.Logf("got: %v", retryErr.Errors)
+		t.Fatalf("unexpected number of attempt errors")
+	}
+	for _, expErr := range expErrs {
+		if !errors.Is(err, expErr) {
+			t.Errorf("error %v does not match %v", err, expErr)
+		}
+	}
+}
+
+func TestAsyncRetryStopsOnNonRetryableError(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	fatal := errors.New("fatal")
+	var attempts atomic.Int32
+	p := AsyncRetry(r, RetryPolicy{
+		Retryable: func(err error) bool { return !errors.Is(err, fatal) },
+	}, func() (string, error) {
+		if attempts.Add(1) == 1 {
+			return "", errors.New("temporary")
+		}
+		return "", fatal
+	})
+
+	_, err := p.ResultTimeout(time.Second)
+	if !errors.Is(err, fatal) {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if n := attempts.Load(); n != 2 {
+		t.Errorf("made %d attempts", n)
+	}
+}
+
+func TestAsyncRetryStopsOnMaxElapsed(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	var attempts atomic.Int32
+	p := AsyncRetry(r, RetryPolicy{
+		MaxAttempts:    -1,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+		MaxElapsed:     35 * time.Millisecond,
+	}, func() (string, error) {
+		attempts.Add(1)
+		return "", errors.New("failed")
+	})
+
+	if _, err := p.ResultTimeout(time.Second); err == nil {
+		t.Fatalf("promise is resolved")
+	}
+	if n := attempts.Load(); n < 2 || n > 4 {
+		t.Errorf("made %d attempts", n)
+	}
+}
+
+func TestAsyncRetryDoesNotHoldWorker(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	p := AsyncRetry(r, RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Hour}, func() (string, error) {
+		return "", errors.New("failed")
+	})
+	t.Cleanup(p.Cancel)
+
+	// wait for the first attempt to fail
+	for {
+		r.mu.Lock()
+		delayed := len(r.delayed)
+		r.mu.Unlock()
+		if delayed != 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	other := AsyncOnRunner(r, func() (string, error) {
+		return "done", nil
+	})
+	if _, err := other.ResultTimeout(time.Second); err != nil {
+		t.Fatalf("worker is held by retry: %v", err)
+	}
+}
+
+func TestAsyncRetryCancelStopsRetries(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	var attempts atomic.Int32
+	p := AsyncRetry(r, RetryPolicy{InitialBackoff: 10 * time.Millisecond}, func() (string, error) {
+		attempts.Add(1)
+		return "", errors.New("failed")
+	})
+	time.Sleep(5 * time.Millisecond)
+	p.Cancel()
+	time.Sleep(30 * time.Millisecond)
+
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("made %d attempts", n)
+	}
+	r.mu.Lock()
+	delayed := len(r.delayed)
+	r.mu.Unlock()
+	if delayed != 0 {
+		t.Errorf("canceled retry is still scheduled")
+	}
+}
+
+func TestAsyncRetryZeroPolicyMakesDefaultAttempts(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	var attempts atomic.Int32
+	p := AsyncRetry(r, RetryPolicy{}, func() (string, error) {
+		attempts.Add(1)
+		return "", errors.New("failed")
+	})
+
+	if _, err := p.ResultTimeout(time.Second); err == nil {
+		t.Fatalf("promise is resolved")
+	}
+	if n := attempts.Load(); n != DefaultRetryMaxAttempts {
+		t.Logf("exp: %d", DefaultRetryMaxAttempts)
+		t.Logf("got: %d", n)
+		t.Error("unexpected number of attempts")
+	}
+}
+
+func TestAsyncRetryKeepsAllErrorsOfLimitedAttempts(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	const maxAttempts = MaxRetryErrors + 5
+	var attempts atomic.Int32
+	p := AsyncRetry(r, RetryPolicy{MaxAttempts: maxAttempts}, func() (string, error) {
+		return "", fmt.Errorf("attempt %d failed", attempts.Add(1))
+	})
+
+	_, err := p.ResultTimeout(time.Second)
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if retryErr.Attempts != maxAttempts || len(retryErr.Errors) != maxAttempts {
+		t.Logf("exp: %d attempts, %d errors", maxAttempts, maxAttempts)
+		t.Logf("got: %d attempts, %d errors", retryErr.Attempts, len(retryErr.Errors))
+		t.Error("unexpected number of attempts or errors")
+	}
+}
+
+func TestAsyncRetryKeepsLastErrorsOfUnlimitedAttempts(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	const attemptsMade = MaxRetryErrors + 5
+	var attempts atomic.Int32
+	p := AsyncRetry(r, RetryPolicy{
+		MaxAttempts: -1,
+		Retryable: func(error) bool {
+			return attempts.Load() < attemptsMade
+		},
+	}, func() (string, error) {
+		return "", fmt.Errorf("attempt %d failed", attempts.Add(1))
+	})
+
+	_, err := p.ResultTimeout(time.Second)
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if retryErr.Attempts != attemptsMade {
+		t.Logf("exp: %d", attemptsMade)
+		t.Logf("got: %d", retryErr.Attempts)
+		t.Error("unexpected number of attempts")
+	}
+	if len(retryErr.Errors) != MaxRetryErrors {
+		t.Fatalf("unexpected number of attempt errors: %d", len(retryErr.Errors))
+	}
+	expected := fmt.Sprintf("attempt %d failed", attemptsMade)
+	if last := retryErr.Errors[MaxRetryErrors-1].Error(); last != expected {
+		t.Logf("exp: %v", expected)
+		t.Logf("got: %v", last)
+		t.Error("unexpected error of the last attempt")
+	}
+}
+
+func TestAsyncRetryDoesNotAccumulateCallbacks(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	var attempts atomic.Int32
+	p := AsyncRetry(r, RetryPolicy{MaxAttempts: -1}, func() (string, error) {
+		attempts.Add(1)
+		return "", errors.New("failed")
+	})
+	t.Cleanup(p.Cancel)
+
+	for attempts.Load() < 100 {
+		time.Sleep(time.Millisecond)
+	}
+	p.mu.Lock()
+	callbacks := len(p.callbacks)
+	p.mu.Unlock()
+	if callbacks != 1 {
+		t.Errorf("promise has %d callbacks after retries", callbacks)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	tt := []struct {
+		policy RetryPolicy
+		n      int
+		exp    time.Duration
+	}{
+		{RetryPolicy{InitialBackoff: time.Millisecond}, 1, time.Millisecond},
+		{RetryPolicy{InitialBackoff: time.Millisecond}, 3, 4 * time.Millisecond},
+		{RetryPolicy{InitialBackoff: time.Millisecond, Multiplier: 3}, 3, 9 * time.Millisecond},
+		{RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}, 10, 5 * time.Millisecond},
+		{RetryPolicy{InitialBackoff: time.Second}, 1000, time.Duration(1<<63 - 1)},
+	}
+	for _, tc := range tt {
+		if got := tc.policy.backoff(tc.n); got != tc.exp {
+			t.Logf("exp: %v", tc.exp)
+			t.Logf("got: %v", got)
+			t.Errorf("unexpected backoff after %d attempts", tc.n)
+		}
+	}
+
+	jittered := RetryPolicy{InitialBackoff: 10 * time.Millisecond, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if got := jittered.backoff(1); got < 5*time.Millisecond || got > 10*time.Millisecond {
+			t.Fatalf("jittered backoff %v is out of range", got)
+		}
+	}
+}
+
+func TestAsyncRetryWithTimeoutNeverOverlaps(t *testing.T) {
+	r := NewRunner(4, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	var attempts, running, overlaps atomic.Int32
+	p := AsyncRetry(r, RetryPolicy{MaxAttempts: 3}, func() (string, error) {
+		attempts.Add(1)
+		if running.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		defer running.Add(-1)
+		time.Sleep(30 * time.Millisecond)
+		return "", nil
+	}, WithTimeout(5*time.Millisecond))
+
+	_, err := p.ResultTimeout(time.Second)
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("made %d attempts", n)
+	}
+	if n := overlaps.Load(); n != 0 {
+		t.Errorf("attempts overlapped %d times", n)
+	}
+}
@@ -0,0 +1,867 @@
+package promise
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRunnerConcurrency = 4
+	DefaultRunnerCapacity    = 100
+)
+
+type execPromise struct {
+	promise  Rejectable
+	exec     func(r *Runner) // r is the runner which executes the promise
+	priority int
+	timeout  time.Duration
+	freed    *freedSignal
+}
+
+// freedSignal is closed once the execution with timeout returns. It could be
+// closed several times, as a handed off task could be submitted again.
+type freedSignal struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func (f *freedSignal) close() {
+	f.once.Do(func() {
+		close(f.ch)
+	})
+}
+
+// TaskOption configures the promise function submitted to the Runner
+type TaskOption func(*execPromise)
+
+// WithPriority sets the priority of the promise function. Workers of the
+// Runner always pick the queued promise with the highest priority, taking into
+// account how long it waits in the queue (see WithPriorityAging). Promises
+// have zero priority by default.
+func WithPriority(priority int) TaskOption {
+	return func(item *execPromise) {
+		item.priority = priority
+	}
+}
+
+// WithTimeout limits the execution time of the promise function to d. If the
+// function does not return in time, then the promise is rejected with
+// *TimeoutError and the context of the function (see AsyncOnRunnerCtx) is
+// canceled with the same error as the cause. The function itself can not be
+// interrupted, so the worker executing it stays busy until it returns.
+func WithTimeout(d time.Duration) TaskOption {
+	return func(item *execPromise) {
+		item.timeout = d
+		item.freed = &freedSignal{ch: make(chan struct{})}
+	}
+}
+
+func (item execPromise) with(opts []TaskOption) execPromise {
+	for _, opt := range opts {
+		opt(&item)
+	}
+	return item
+}
+
+// timedOut returns the channel which is closed once the worker executing item
+// is freed, if err is the error of item exceeding its timeout. Otherwise it
+// returns nil, as the execution of item is either finished or never started
+// by the time its promise is settled.
+func (item execPromise) timedOut(err error) <-chan struct{} {
+	var timeoutErr *TimeoutError
+	if item.freed == nil || !errors.As(err, &timeoutErr) || timeoutErr.freed != item.freed.ch {
+		return nil
+	}
+	return item.freed.ch
+}
+
+func newExecPromise[T any](promise *Promise[T], impl func() (T, error)) execPromise {
+	return newExecPromiseOn(promise, func(*Runner) (T, error) {
+		return impl()
+	})
+}
+
+// newExecPromiseOn is the same as newExecPromise, but impl receives the
+// runner which executes it. It could differ from the runner impl was submitted
+// to, if the promise was handed off to another runner.
+func newExecPromiseOn[T any](promise *Promise[T], impl func(*Runner) (T, error)) execPromise {
+	return execPromise{
+		promise: promise,
+		exec: func(r *Runner) {
+			select {
+			case <-promise.Done():
+				// promise was canceled or rejected while waiting
+				// for execution, so there is no need to execute it.
+				return
+			default:
+			}
+			result, err := impl(r)
+			if err != nil {
+				promise.Reject(err)
+			} else {
+				promise.Resolve(result)
+			}
+		},
+	}
+}
+
+// dispatched is a callback scheduled on a runner. Rejecting it calls it
+// inline, so the callback is executed exactly once even if the runner
+// refuses to execute it.
+type dispatched func()
+
+func (fn dispatched) Reject(err error) {
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		fn()
+	}
+}
+
+// PanicError is the error of a promise whose function panicked
+type PanicError struct {
+	// Value is the value recovered from the panic
+	Value any
+	// Stack is the stack trace of the goroutine which panicked
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("promise function panicked: %v", e.Value)
+}
+
+// Unwrap returns the recovered value if it is an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// TimeoutError is the error of a promise whose function did not return within
+// the timeout set by WithTimeout. It matches context.DeadlineExceeded.
+type TimeoutError struct {
+	Timeout time.Duration
+	freed   chan struct{}
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("promise function timed out after %v", e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// Freed returns a channel which is closed once the timed out function returns
+// and the worker executing it is freed. The channel is never closed if the
+// function never returns.
+func (e *TimeoutError) Freed() <-chan struct{} {
+	return e.freed
+}
+
+// Runner executes promise functions on a fixed number of workers. Promises
+// are queued until one of the workers is free to execute them.
+//
+// Every promise submitted to the Runner is guaranteed to be either executed
+// or rejected with ErrExecutionDone, even if it races with Wait or Shutdown.
+type Runner struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond // signaled when a promise is queued or runner stops
+	notFull  *sync.Cond // signaled when a promise is dequeued or runner stops
+	queue    taskQueue
+	capacity int
+	conc     int  // desired number of workers
+	workers  int  // number of running workers
+	idle     int  // number of workers waiting for promises
+	stopped  bool // runner does not accept new promises
+	aborted  bool // workers do not execute queued promises
+	onPanic  func(*PanicError)
+
+	saturation SaturationPolicy
+	delayed    map[*delayedItem]struct{}
+
+	// elastic runner starts up to maxConc workers while there are queued
+	// promises, extra workers exit after being idle for idleTimeout.
+	maxConc     int
+	idleTimeout time.Duration
+
+	// wg, ctx and cancel are replaced each time the runner is started.
+	// ctx is canceled once the runner is shut down.
+	wg     *sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// RunnerOption configures the Runner
+type RunnerOption func(*Runner)
+
+// WithPanicHandler sets fn to be called each time a function executed by the
+// Runner panics. The panic is recovered anyway and the promise of the function
+// is rejected with *PanicError, fn is only a notification.
+func WithPanicHandler(fn func(*PanicError)) RunnerOption {
+	return func(r *Runner) {
+		r.onPanic = fn
+	}
+}
+
+// SaturationPolicy defines how the Runner handles new promises while it is at
+// its capacity. It does not affect TryAsyncOnRunner, which always rejects new
+// promises with ErrRunnerFull.
+type SaturationPolicy int
+
+const (
+	// SaturationBlock blocks the submitter until there is a room in the queue
+	SaturationBlock SaturationPolicy = iota
+	// SaturationRejectNew rejects new promise with ErrRunnerFull
+	SaturationRejectNew
+	// SaturationDropOldest rejects the oldest queued promise with
+	// ErrRunnerFull to make a room for the new one
+	SaturationDropOldest
+	// SaturationCallerRuns executes new promise synchronously on the
+	// submitting goroutine
+	SaturationCallerRuns
+)
+
+// WithSaturationPolicy sets the policy for handling new promises while the
+// Runner is at its capacity. SaturationBlock is used by default. The policy
+// does not apply to continuations and callbacks (e.g. of Then, Catch or
+// OnResolveOnRunner), which are queued regardless of the capacity, see Cap.
+func WithSaturationPolicy(policy SaturationPolicy) RunnerOption {
+	return func(r *Runner) {
+		r.saturation = policy
+	}
+}
+
+// WithPriorityAging sets the time a queued promise waits to gain one priority
+// level, which protects promises with low priority from starvation. Aging
+// less or equal to zero makes priority strict. DefaultPriorityAging is used by
+// default.
+func WithPriorityAging(aging time.Duration) RunnerOption {
+	return func(r *Runner) {
+		r.queue.aging = aging
+	}
+}
+
+// WithElasticWorkers makes the Runner elastic. The number of workers passed to
+// NewRunner (or Resize) becomes the minimal one. While there are queued
+// promises and no idle workers, the runner starts new workers up to maxConc.
+// Workers above the minimal number exit after being idle for idleTimeout.
+func WithElasticWorkers(maxConc int, idleTimeout time.Duration) RunnerOption {
+	return func(r *Runner) {
+		r.maxConc = maxConc
+		r.idleTimeout = idleTimeout
+	}
+}
+
+// NewRunner starts the Runner with conc workers, which queues at most
+// capacity promises before blocking the submitters. Capacity less then 1 is
+// treated as 1.
+func NewRunner(conc int, capacity int, opts ...RunnerOption) *Runner {
+	r := &Runner{
+		queue:    taskQueue{aging: DefaultPriorityAging},
+		delayed:  make(map[*delayedItem]struct{}),
+		capacity: max(capacity, 1),
+		conc:     conc,
+	}
+	r.notEmpty = sync.NewCond(&r.mu)
+	r.notFull = sync.NewCond(&r.mu)
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.mu.Lock()
+	r.start()
+	r.mu.Unlock()
+
+	return r
+}
+
+// Cap returns the maximum amount of promises this Runner can queue until
+// submitters block or are rejected with ErrRunnerFull. Continuations and
+// callbacks (e.g. of Then, Catch or OnResolveOnRunner) are exempt from this
+// limit: they are queued by the goroutine which settles a promise, which
+// could be a worker of the runner, so they never block and are never
+// rejected. Because of them the queue could temporarily hold more than Cap
+// promises, in which case new promises are handled as if it is full.
+func (r *Runner) Cap() int {
+	return r.capacity
+}
+
+// start starts workers of the runner, r.mu must be held
+func (r *Runner) start() {
+	r.stopped = false
+	r.aborted = false
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	r.wg = &sync.WaitGroup{}
+	r.spawn(r.conc)
+}
+
+// spawn starts n more workers, r.mu must be held
+func (r *Runner) spawn(n int) {
+	r.workers += n
+	r.wg.Add(n)
+	for i := 0; i < n; i++ {
+		go r.work(r.wg)
+	}
+}
+
+// Resize changes the number of workers of the runner to n. New workers are
+// started immediately, while extra workers exit once they are done with their
+// current promise. If the runner is stopped, then n workers are started on
+// Restart. For elastic runner n is the minimal number of workers.
+func (r *Runner) Resize(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.conc = max(n, 0)
+	if r.stopped {
+		return
+	}
+	if r.workers < r.conc {
+		r.spawn(r.conc - r.workers)
+	} else {
+		// wake up idle workers to let extra ones exit
+		r.notEmpty.Broadcast()
+	}
+}
+
+// Restart starts the runner stopped by Wait, Shutdown, Stop or Handoff again
+// with the same number of workers. It waits for the workers of the stopped
+// runner to exit first. Shutdown which is still in progress does not affect
+// the restarted runner. Restart does nothing if the runner is not stopped.
+func (r *Runner) Restart() {
+	r.mu.Lock()
+	if !r.stopped {
+		r.mu.Unlock()
+		return
+	}
+	wg := r.wg
+	r.mu.Unlock()
+
+	wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped && r.wg == wg {
+		r.start()
+	}
+}
+
+// context returns the context which is canceled once the runner is shut down
+func (r *Runner) context() context.Context {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ctx
+}
+
+func (r *Runner) work(wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		item, ok := r.next()
+		if !ok {
+			return
+		}
+		r.run(item)
+	}
+}
+
+// next blocks until there is a queued promise to execute. It returns false
+// once the worker should exit: the runner is stopped and there is nothing
+// left in the queue, the runner has more workers than needed, or the worker
+// of elastic runner was idle for too long.
+func (r *Runner) next() (execPromise, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	idleSince := time.Now()
+	for {
+		switch {
+		case r.aborted, r.workers > r.maxWorkers():
+			r.workers--
+			return execPromise{}, false
+		case r.queue.Len() > 0:
+			return r.pop(), true
+		case r.stopped, r.idleExpired(idleSince):
+			r.workers--
+			return execPromise{}, false
+		}
+
+		r.idle++
+		r.waitIdle(idleSince)
+		r.idle--
+	}
+}
+
+// maxWorkers returns the maximal number of workers, r.mu must be held
+func (r *Runner) maxWorkers() int {
+	return max(r.conc, r.maxConc)
+}
+
+// idleExpired returns true if the worker idle since the given time should
+// exit, r.mu must be held
+func (r *Runner) idleExpired(since time.Time) bool {
+	return r.workers > r.conc && r.idleTimeout > 0 && time.Since(since) >= r.idleTimeout
+}
+
+// waitIdle waits for the runner state to change, r.mu must be held. Workers
+// which could exit on idle timeout are woken up once the timeout expires.
+func (r *Runner) waitIdle(since time.Time) {
+	if r.workers > r.conc && r.idleTimeout > 0 {
+		timer := time.AfterFunc(r.idleTimeout-time.Since(since), func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.notEmpty.Broadcast()
+		})
+		defer timer.Stop()
+	}
+	r.notEmpty.Wait()
+}
+
+// grow starts a new worker of elastic runner if none of the workers is idle,
+// r.mu must be held
+func (r *Runner) grow() {
+	if !r.stopped && r.queue.Len() > r.idle && r.workers < r.maxWorkers() {
+		r.spawn(1)
+	}
+}
+
+// abort makes workers wg exit after their current promise, leaving the rest
+// of the queue untouched. It does nothing if the runner was restarted since
+// wg was started.
+func (r *Runner) abort(wg *sync.WaitGroup) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.wg != wg {
+		return
+	}
+	r.aborted = true
+	r.notEmpty.Broadcast()
+}
+
+// takeQueue removes all queued promises from the runner, unless the runner
+// was restarted since workers wg were started. In the latter case the queue
+// belongs to the new workers.
+func (r *Runner) takeQueue(wg *sync.WaitGroup) []execPromise {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.wg != wg {
+		return nil
+	}
+	queue := r.queue.take()
+	r.notFull.Broadcast()
+	return queue
+}
+
+// Wait executes all pending promises and stops
+// execution of all further promises. Wait drains the queue of the runner, use
+// Stop to reject queued promises instead.
+func (r *Runner) Wait() {
+	_ = r.Shutdown(context.Background())
+}
+
+// Stop stops execution of all further promises. Workers stop after their
+// current promise, contexts of running promises are canceled and all queued
+// promises are rejected with ErrExecutionDone, as well as promises scheduled
+// with AsyncAfter or AsyncAt. Stop rejects the queue of the runner, use Wait to
+// execute queued promises instead.
+func (r *Runner) Stop() {
+	queue, wg := r.halt()
+	for _, item := range queue {
+		item.promise.Reject(ErrExecutionDone)
+	}
+	wg.Wait()
+}
+
+// halt stops accepting and executing promises, cancels contexts of running
+// promises and returns the queue of the runner with the workers to wait for
+func (r *Runner) halt() ([]execPromise, *sync.WaitGroup) {
+	r.mu.Lock()
+	r.stopped = true
+	r.aborted = true
+	r.notEmpty.Broadcast()
+	r.notFull.Broadcast()
+	cancel, wg := r.cancel, r.wg
+	delayed := r.takeDelayed()
+	queue := r.queue.take()
+	r.mu.Unlock()
+
+	cancel()
+	RejectAll(ErrExecutionDone, delayed)
+	return queue, wg
+}
+
+// Task is a promise function which was queued on a runner, but not started.
+// Its promise stays pending until the task is either submitted to another
+// runner or rejected.
+type Task struct {
+	item execPromise
+}
+
+// Promise returns the promise of the task. It is the *Promise[T] returned when
+// the task was submitted, so it could be compared with or type asserted to it.
+func (t Task) Promise() Rejectable {
+	return t.item.promise
+}
+
+// Submit schedules the task for execution on the runner r, the same way
+// AsyncOnRunner does.
+func (t Task) Submit(r *Runner) {
+	r.enqueue(context.Background(), t.item)
+}
+
+// Reject rejects the promise of the task
+func (t Task) Reject(err error) {
+	t.item.promise.Reject(err)
+}
+
+// Handoff stops the runner the same way Stop does, but instead of rejecting
+// queued promises returns them as tasks, so they could be submitted to
+// another runner. Promises which were settled while queued (e.g. canceled)
+// are not returned. Promises scheduled with AsyncAfter or AsyncAt, which are
+// not queued yet, are rejected with ErrExecutionDone.
+func (r *Runner) Handoff() []Task {
+	queue, wg := r.halt()
+	wg.Wait()
+
+	tasks := make([]Task, 0, len(queue))
+	for _, item := range queue {
+		if fn, ok := item.promise.(dispatched); ok {
+			// callbacks are never handed off
+			fn.Reject(ErrExecutionDone)
+			continue
+		}
+		if p, ok := item.promise.(interface{ Done() <-chan struct{} }); ok {
+			select {
+			case <-p.Done():
+				continue
+			default:
+			}
+		}
+		tasks = append(tasks, Task{item: item})
+	}
+	return tasks
+}
+
+// ShutdownError is returned by Runner.Shutdown if some of the queued
+// promises were not executed before the shutdown deadline.
+type ShutdownError struct {
+	// Dropped is the number of queued promises rejected with ErrExecutionDone
+	Dropped int
+	// Err is the cause of the shutdown context cancelation
+	Err error
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("runner shutdown: %d queued promises dropped: %v", e.Dropped, e.Err)
+}
+
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
+// Shutdown stops execution of all further promises and executes all queued
+// promises until ctx is done. Once ctx is done, contexts of all running
+// promises are canceled and all queued promises which are not started yet are
+// rejected with ErrExecutionDone. In this case Shutdown returns
+// *ShutdownError with the number of rejected promises. Queued callbacks (e.g.
+// of OnResolveOnRunner or FinallyOnRunner) are never dropped, they are called
+// inline by Shutdown instead, even once ctx is done.
+//
+// Promises scheduled with AsyncAfter or AsyncAt, which are not queued yet, are
+// rejected with ErrExecutionDone right away.
+//
+// Shutdown returns immediately if the runner is already shut down.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return nil
+	}
+	r.stopped = true
+	// wake up idle workers to let them exit once the queue is empty,
+	// and blocked submitters to let them reject their promises.
+	r.notEmpty.Broadcast()
+	r.notFull.Broadcast()
+	cancel, wg := r.cancel, r.wg
+	delayed := r.takeDelayed()
+	r.mu.Unlock()
+
+	RejectAll(ErrExecutionDone, delayed)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() {
+		r.abort(wg)
+		cancel()
+	})
+	defer stop()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		wg.Wait()
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+	}
+
+	// queue is empty at this point unless ctx is done
+	// or the runner has no workers at all.
+	dropped := 0
+	for _, item := range r.takeQueue(wg) {
+		select {
+		case <-ctx.Done():
+			if _, ok := item.promise.(dispatched); !ok {
+				dropped++
+			}
+			// rejected callback is called inline
+			item.promise.Reject(ErrExecutionDone)
+		default:
+			r.run(item)
+		}
+	}
+
+	if dropped > 0 {
+		return &ShutdownError{Dropped: dropped, Err: context.Cause(ctx)}
+	}
+	return nil
+}
+
+// run executes item, converting a panic or exceeded timeout into the
+// rejection of its promise
+func (r *Runner) run(item execPromise) {
+	if item.timeout > 0 {
+		defer item.freed.close()
+		timer := time.AfterFunc(item.timeout, func() {
+			item.promise.Reject(&TimeoutError{Timeout: item.timeout, freed: item.freed.ch})
+		})
+		defer timer.Stop()
+	}
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		err := &PanicError{Value: v, Stack: debug.Stack()}
+		item.promise.Reject(err)
+		if r.onPanic != nil {
+			r.onPanic(err)
+		}
+	}()
+	item.exec(r)
+}
+
+// DefaultRunner is the runner used by package level functions. Use
+// SetDefaultRunner or ResetDefaultRunner to replace it, assigning it directly
+// is not safe while those functions are in use.
+var DefaultRunner = NewRunner(DefaultRunnerConcurrency, DefaultRunnerCapacity)
+
+var defaultRunnerMu sync.RWMutex
+
+func defaultRunner() *Runner {
+	defaultRunnerMu.RLock()
+	defer defaultRunnerMu.RUnlock()
+	return DefaultRunner
+}
+
+// SetDefaultRunner replaces the DefaultRunner with r and returns the previous
+// one. The previous runner is not stopped.
+func SetDefaultRunner(r *Runner) *Runner {
+	defaultRunnerMu.Lock()
+	defer defaultRunnerMu.Unlock()
+	prev := DefaultRunner
+	DefaultRunner = r
+	return prev
+}
+
+// ResetDefaultRunner replaces the DefaultRunner with a new runner with the
+// default concurrency and capacity and returns the previous one. The previous
+// runner is not stopped.
+func ResetDefaultRunner() *Runner {
+	return SetDefaultRunner(NewRunner(DefaultRunnerConcurrency, DefaultRunnerCapacity))
+}
+
+func Async[T any](impl func() (T, error), opts ...TaskOption) *Promise[T] {
+	return AsyncOnRunner(defaultRunner(), impl, opts...)
+}
+
+// Wait executes all pending promises of the DefaultRunner, see Runner.Wait
+func Wait() {
+	defaultRunner().Wait()
+}
+
+// Stop rejects all pending promises of the DefaultRunner, see Runner.Stop
+func Stop() {
+	defaultRunner().Stop()
+}
+
+func AsyncOnRunner[T any](r *Runner, impl func() (T, error), opts ...TaskOption) *Promise[T] {
+	promise := NewPromise[T]()
+	r.enqueue(context.Background(), newExecPromise(promise, impl).with(opts))
+	return promise
+}
+
+// AsyncWithPriority is the same as AsyncOnRunner with WithPriority option
+func AsyncWithPriority[T any](r *Runner, priority int, impl func() (T, error)) *Promise[T] {
+	return AsyncOnRunner(r, impl, WithPriority(priority))
+}
+
+// TryAsync is the same as Async, but never blocks the caller, see
+// TryAsyncOnRunner.
+func TryAsync[T any](impl func() (T, error), opts ...TaskOption) *Promise[T] {
+	return TryAsyncOnRunner(defaultRunner(), impl, opts...)
+}
+
+// TryAsyncOnRunner is the same as AsyncOnRunner, but never blocks the caller.
+// If the runner r is at its capacity (see Runner.Cap), then the returned
+// promise is rejected with ErrRunnerFull.
+func TryAsyncOnRunner[T any](r *Runner, impl func() (T, error), opts ...TaskOption) *Promise[T] {
+	promise := NewPromise[T]()
+	r.tryEnqueue(newExecPromise(promise, impl).with(opts))
+	return promise
+}
+
+// AsyncCtx is the same as Async, but impl accepts the context, see
+// AsyncOnRunnerCtx.
+func AsyncCtx[T any](ctx context.Context, impl func(context.Context) (T, error), opts ...TaskOption) *Promise[T] {
+	return AsyncOnRunnerCtx(ctx, defaultRunner(), impl, opts...)
+}
+
+// AsyncOnRunnerCtx schedules impl for execution on the runner r. The context
+// passed to impl is derived from ctx and is canceled once ctx is done, the
+// returned promise is settled (e.g. canceled) or the runner executing impl is
+// shut down. If the context is canceled because the promise was settled by
+// someone else, then context.Cause returns the error of the promise (e.g.
+// ErrCanceled).
+//
+// While r is at its capacity AsyncOnRunnerCtx blocks the caller until ctx is
+// done. In this case the returned promise is rejected with the cause of ctx
+// cancelation.
+func AsyncOnRunnerCtx[T any](ctx context.Context, r *Runner, impl func(context.Context) (T, error), opts ...TaskOption) *Promise[T] {
+	promise := NewPromise[T]()
+	ctx, item := newExecPromiseCtx(ctx, promise, impl)
+	r.enqueue(ctx, item.with(opts))
+	return promise
+}
+
+// newExecPromiseCtx is the same as newExecPromise, but impl receives the
+// context derived from ctx as described in AsyncOnRunnerCtx. The derived
+// context is returned as well.
+func newExecPromiseCtx[T any](ctx context.Context, promise *Promise[T], impl func(context.Context) (T, error)) (context.Context, execPromise) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	promise.whenSettled(func() {
+		cancel(promise.err)
+	})
+	return ctx, newExecPromiseOn(promise, func(r *Runner) (T, error) {
+		stop := context.AfterFunc(r.context(), func() {
+			cancel(ErrExecutionDone)
+		})
+		defer stop()
+		return impl(ctx)
+	})
+}
+
+// enqueue schedules item for execution on r. While r is at its capacity
+// enqueue follows the saturation policy of r. If r is not accepting promises
+// anymore, then item is rejected with ErrExecutionDone. If ctx is done before
+// item is queued, then item is rejected with the cause of ctx cancelation.
+func (r *Runner) enqueue(ctx context.Context, item execPromise) {
+	r.mu.Lock()
+	if !r.stopped && r.queue.Len() >= r.capacity {
+		switch r.saturation {
+		case SaturationRejectNew:
+			r.mu.Unlock()
+			item.promise.Reject(ErrRunnerFull)
+			return
+		case SaturationDropOldest:
+			oldest := r.queue.popOldest()
+			r.notFull.Signal()
+			r.push(item)
+			r.mu.Unlock()
+			oldest.promise.Reject(ErrRunnerFull)
+			return
+		case SaturationCallerRuns:
+			r.mu.Unlock()
+			r.run(item)
+			return
+		}
+		if ctx.Done() != nil {
+			// wake up blocked submitters once ctx is done
+			stop := context.AfterFunc(ctx, func() {
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				r.notFull.Broadcast()
+			})
+			defer stop()
+		}
+	}
+	for !r.stopped && r.queue.Len() >= r.capacity && ctx.Err() == nil {
+		r.notFull.Wait()
+	}
+	switch {
+	case r.stopped:
+		r.mu.Unlock()
+		item.promise.Reject(ErrExecutionDone)
+	case ctx.Err() != nil:
+		r.mu.Unlock()
+		item.promise.Reject(context.Cause(ctx))
+	default:
+		r.push(item)
+		r.mu.Unlock()
+	}
+}
+
+// tryEnqueue is the same as enqueue, but never blocks the caller. If r is at
+// its capacity, then item is rejected with ErrRunnerFull.
+func (r *Runner) tryEnqueue(item execPromise) {
+	r.mu.Lock()
+	switch {
+	case r.stopped:
+		r.mu.Unlock()
+		item.promise.Reject(ErrExecutionDone)
+	case r.queue.Len() >= r.capacity:
+		r.mu.Unlock()
+		item.promise.Reject(ErrRunnerFull)
+	default:
+		r.push(item)
+		r.mu.Unlock()
+	}
+}
+
+// pop removes the item with the highest priority from the queue, r.mu must
+// be held
+func (r *Runner) pop() execPromise {
+	item := r.queue.pop()
+	r.notFull.Signal()
+	return item
+}
+
+// push adds item to the queue, r.mu must be held
+func (r *Runner) push(item execPromise) {
+	r.queue.push(item)
+	r.notEmpty.Signal()
+	r.grow()
+}
+
+// enqueueNoWait is the same as enqueue, but never blocks the caller and
+// ignores the capacity of r. It is used from promise callbacks, which could
+// be called by the runner workers.
+func (r *Runner) enqueueNoWait(item execPromise) {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		item.promise.Reject(ErrExecutionDone)
+		return
+	}
+	r.push(item)
+	r.mu.Unlock()
+}
+
+// dispatch schedules fn for execution on r without blocking the caller. If r
+// is not accepting promises anymore, then fn is called inline.
+func (r *Runner) dispatch(fn func()) {
+	r.enqueueNoWait(execPromise{
+		promise: dispatched(fn),
+		exec: func(*Runner) {
+			fn()
+		},
+	})
+}
@@ -0,0 +1,621 @@
+package promise
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunnerSettlesEveryPromiseRacingWithWait(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		r := NewRunner(DefaultRunnerConcurrency, 10)
+
+		const submitters = 16
+		var wg sync.WaitGroup
+		promises := make(chan *Promise[int], submitters*100)
+		wg.Add(submitters)
+		for i := 0; i < submitters; i++ {
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					promises <- AsyncOnRunner(r, func() (int, error) {
+						return j, nil
+					})
+				}
+			}()
+		}
+
+		waited := make(chan struct{})
+		go func() {
+			defer close(waited)
+			time.Sleep(time.Duration(round) * 10 * time.Microsecond)
+			r.Wait()
+		}()
+
+		wg.Wait()
+		close(promises)
+		<-waited
+
+		for p := range promises {
+			_, err := p.ResultTimeout(time.Second)
+			if err != nil && !errors.Is(err, ErrExecutionDone) {
+				t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+			}
+		}
+	}
+}
+
+func TestRunnerWaitRejectsBlockedSubmitters(t *testing.T) {
+	r := NewRunner(1, 1)
+
+	release := make(chan struct{})
+	_ = AsyncOnRunner(r, func() (int, error) {
+		<-release
+		return 0, nil
+	})
+	// fill the queue, so the next submitter blocks
+	_ = AsyncOnRunner(r, func() (int, error) {
+		return 0, nil
+	})
+
+	blocked := make(chan *Promise[int])
+	go func() {
+		blocked <- AsyncOnRunner(r, func() (int, error) {
+			return 0, nil
+		})
+	}()
+
+	waited := make(chan struct{})
+	go func() {
+		defer close(waited)
+		r.Wait()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	<-waited
+
+	p := <-blocked
+	_, err := p.ResultTimeout(time.Second)
+	if err != nil && !errors.Is(err, ErrExecutionDone) {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+}
+
+func TestRunnerStopRejectsQueuedPromises(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	running := AsyncOnRunner(r, func() (string, error) {
+		close(started)
+		<-release
+		return "hello world", nil
+	})
+	queued := make([]*Promise[int], 3)
+	for i := range queued {
+		queued[i] = AsyncOnRunner(r, func() (int, error) {
+			return i, nil
+		})
+	}
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		r.Stop()
+	}()
+
+	for i := range queued {
+		_, err := queued[i].ResultTimeout(time.Second)
+		if !errors.Is(err, ErrExecutionDone) {
+			t.Logf("exp: %v", ErrExecutionDone)
+			t.Logf("got: %v", err)
+			t.Error("unexpected error of queued promise")
+		}
+	}
+
+	// Stop waits for the running promise to be done
+	select {
+	case <-stopped:
+		t.Fatalf("stop returned before running promise is done")
+	default:
+	}
+	close(release)
+	<-stopped
+
+	actual, err := running.Result()
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if actual != "hello world" {
+		t.Logf("exp: %s", "hello world")
+		t.Logf("got: %s", actual)
+		t.Error("unexpected value of running promise")
+	}
+
+	_, err = AsyncOnRunner(r, func() (int, error) {
+		return 0, nil
+	}).Result()
+	if !errors.Is(err, ErrExecutionDone) {
+		t.Logf("exp: %v", ErrExecutionDone)
+		t.Logf("got: %v", err)
+		t.Error("unexpected error for promise on stopped runner")
+	}
+}
+
+func TestRunnerHandoffReturnsUnstartedTasks(t *testing.T) {
+	// runner without workers never starts queued promises
+	r1 := NewRunner(0, DefaultRunnerCapacity)
+
+	queued := AsyncOnRunner(r1, func() (string, error) {
+		return "hello world", nil
+	})
+	queuedCtx := AsyncOnRunnerCtx(context.Background(), r1, func(ctx context.Context) (string, error) {
+		return "hello context", ctx.Err()
+	})
+	canceled := AsyncOnRunner(r1, func() (string, error) {
+		return "", nil
+	})
+	canceled.Cancel()
+
+	tasks := r1.Handoff()
+
+	if len(tasks) != 2 {
+		t.Fatalf("unexpected number of handed off tasks: %d", len(tasks))
+	}
+	if _, _, ok := queued.TryResult(); ok {
+		t.Fatalf("handed off promise is settled")
+	}
+
+	r2 := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r2.Wait)
+	for _, task := range tasks {
+		task.Submit(r2)
+	}
+
+	actual, err := queued.ResultTimeout(time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if actual != "hello world" {
+		t.Logf("exp: %s", "hello world")
+		t.Logf("got: %s", actual)
+		t.Error("unexpected value of handed off promise")
+	}
+
+	actual, err = queuedCtx.ResultTimeout(time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if actual != "hello context" {
+		t.Logf("exp: %s", "hello context")
+		t.Logf("got: %s", actual)
+		t.Error("unexpected value of handed off promise")
+	}
+}
+
+func TestRunnerHandoffTaskPromise(t *testing.T) {
+	r := NewRunner(0, DefaultRunnerCapacity)
+
+	first := AsyncOnRunner(r, func() (string, error) {
+		return "", nil
+	})
+	second := AsyncOnRunner(r, func() (int, error) {
+		return 0, nil
+	})
+
+	tasks := r.Handoff()
+	if len(tasks) != 2 {
+		t.Fatalf("unexpected number of handed off tasks: %d", len(tasks))
+	}
+	if p, ok := tasks[0].Promise().(*Promise[string]); !ok || p != first {
+		t.Errorf("unexpected promise of the first task: %v", tasks[0].Promise())
+	}
+	if tasks[1].Promise() != Rejectable(second) {
+		t.Errorf("unexpected promise of the second task: %v", tasks[1].Promise())
+	}
+}
+
+func TestRunnerRestart(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	// restart of the running runner does nothing
+	r.Restart()
+	r.Wait()
+
+	_, err := AsyncOnRunner(r, func() (string, error) {
+		return "", nil
+	}).Result()
+	if !errors.Is(err, ErrExecutionDone) {
+		t.Logf("exp: %v", ErrExecutionDone)
+		t.Logf("got: %v", err)
+		t.Fatalf("unexpected error for promise on waited runner")
+	}
+
+	r.Restart()
+
+	expected := "hello world"
+	actual, err := AsyncOnRunner(r, func() (string, error) {
+		return expected, nil
+	}).ResultTimeout(time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if expected != actual {
+		t.Logf("exp: %s", expected)
+		t.Logf("got: %s", actual)
+		t.Error("unexpected promise value")
+	}
+}
+
+func TestRunnerRestartDuringShutdown(t *testing.T) {
+	// runner without workers leaves queued promises to Shutdown
+	r := NewRunner(0, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	_ = AsyncOnRunner(r, func() (string, error) {
+		close(started)
+		<-release
+		return "", nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		_ = r.Shutdown(ctx)
+	}()
+	defer func() {
+		close(release)
+		<-shutdown
+	}()
+
+	// shutdown executes the queued promise inline
+	<-started
+	r.Restart()
+	r.Resize(1)
+
+	// let the shutdown deadline pass while shutdown is still in progress
+	<-ctx.Done()
+	time.Sleep(10 * time.Millisecond)
+
+	_, err := AsyncOnRunner(r, func() (string, error) {
+		return "", nil
+	}).ResultTimeout(time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error on restarted runner %[1]v (%[1]T)", err)
+	}
+}
+
+func TestResetDefaultRunner(t *testing.T) {
+	prev := SetDefaultRunner(NewRunner(1, DefaultRunnerCapacity))
+	t.Cleanup(func() {
+		SetDefaultRunner(prev).Wait()
+	})
+
+	Wait()
+	_, err := Async(func() (string, error) {
+		return "", nil
+	}).Result()
+	if !errors.Is(err, ErrExecutionDone) {
+		t.Logf("exp: %v", ErrExecutionDone)
+		t.Logf("got: %v", err)
+		t.Fatalf("unexpected error for promise on waited default runner")
+	}
+
+	ResetDefaultRunner()
+
+	expected := "hello world"
+	actual, err := Async(func() (string, error) {
+		return expected, nil
+	}).ResultTimeout(time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if expected != actual {
+		t.Logf("exp: %s", expected)
+		t.Logf("got: %s", actual)
+		t.Error("unexpected promise value")
+	}
+}
+
+func TestRunnerResize(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		_ = AsyncOnRunner(r, func() (int, error) {
+			started <- struct{}{}
+			<-release
+			return i, nil
+		})
+	}
+
+	r.Resize(3)
+	for i := 0; i < 3; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d promises started after runner was resized", i)
+		}
+	}
+
+	r.Resize(1)
+	close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		r.mu.Lock()
+		workers := r.workers
+		r.mu.Unlock()
+		if workers == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected number of workers after shrinking: %d", workers)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestElasticRunnerGrowsAndShrinks(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity, WithElasticWorkers(3, 10*time.Millisecond))
+	t.Cleanup(r.Wait)
+
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	ps := make([]*Promise[int], 3)
+	for i := range ps {
+		ps[i] = AsyncOnRunner(r, func() (int, error) {
+			started <- struct{}{}
+			<-release
+			return i, nil
+		})
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d promises started on elastic runner", i)
+		}
+	}
+	close(release)
+	if _, err := All(ps...).ResultTimeout(time.Second); err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		r.mu.Lock()
+		workers := r.workers
+		r.mu.Unlock()
+		if workers == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected number of workers of idle elastic runner: %d", workers)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTryAsyncOnFullRunner(t *testing.T) {
+	// runner without workers never dequeues promises
+	r := NewRunner(0, 3)
+	t.Cleanup(r.Stop)
+
+	if r.Cap() != 3 {
+		t.Logf("exp: %d", 3)
+		t.Logf("got: %d", r.Cap())
+		t.Error("unexpected runner capacity")
+	}
+	for i := 0; i < r.Cap(); i++ {
+		queued := TryAsyncOnRunner(r, func() (int, error) {
+			return 0, nil
+		})
+		if _, err, ok := queued.TryResult(); ok {
+			t.Fatalf("unexpected error of queued promise: %v", err)
+		}
+	}
+
+	_, err, ok := TryAsyncOnRunner(r, func() (int, error) {
+		return 0, nil
+	}).TryResult()
+	if !ok {
+		t.Fatalf("promise on full runner is not rejected immediately")
+	}
+	if !errors.Is(err, ErrRunnerFull) {
+		t.Logf("exp: %v", ErrRunnerFull)
+		t.Logf("got: %v", err)
+		t.Error("unexpected error of promise on full runner")
+	}
+}
+
+func TestAsyncCtxOnFullRunnerIsBoundedByContext(t *testing.T) {
+	r := NewRunner(0, 1)
+	t.Cleanup(r.Stop)
+
+	_ = AsyncOnRunner(r, func() (int, error) {
+		return 0, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	submitted := make(chan *Promise[int])
+	go func() {
+		submitted <- AsyncOnRunnerCtx(ctx, r, func(context.Context) (int, error) {
+			return 0, nil
+		})
+	}()
+
+	select {
+	case p := <-submitted:
+		_, err, ok := p.TryResult()
+		if !ok {
+			t.Fatalf("promise is not rejected after submit context is done")
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Logf("exp: %v", context.DeadlineExceeded)
+			t.Logf("got: %v", err)
+			t.Error("unexpected error of promise on full runner")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("submit is not bounded by context")
+	}
+}
+
+func TestRunnerSaturationRejectNew(t *testing.T) {
+	r := NewRunner(0, 1, WithSaturationPolicy(SaturationRejectNew))
+	t.Cleanup(r.Stop)
+
+	queued := AsyncOnRunner(r, func() (int, error) {
+		return 1, nil
+	})
+	rejected := AsyncOnRunner(r, func() (int, error) {
+		return 2, nil
+	})
+
+	if _, _, ok := queued.TryResult(); ok {
+		t.Errorf("queued promise is settled")
+	}
+	_, err, _ := rejected.TryResult()
+	if !errors.Is(err, ErrRunnerFull) {
+		t.Logf("exp: %v", ErrRunnerFull)
+		t.Logf("got: %v", err)
+		t.Error("unexpected error of new promise")
+	}
+}
+
+func TestRunnerSaturationDropOldest(t *testing.T) {
+	r := NewRunner(0, 1, WithSaturationPolicy(SaturationDropOldest))
+	t.Cleanup(r.Stop)
+
+	dropped := AsyncOnRunner(r, func() (int, error) {
+		return 1, nil
+	})
+	queued := AsyncOnRunner(r, func() (int, error) {
+		return 2, nil
+	})
+
+	if _, _, ok := queued.TryResult(); ok {
+		t.Errorf("queued promise is settled")
+	}
+	_, err, _ := dropped.TryResult()
+	if !errors.Is(err, ErrRunnerFull) {
+		t.Logf("exp: %v", ErrRunnerFull)
+		t.Logf("got: %v", err)
+		t.Error("unexpected error of dropped promise")
+	}
+}
+
+func TestRunnerSaturationCallerRuns(t *testing.T) {
+	r := NewRunner(0, 1, WithSaturationPolicy(SaturationCallerRuns))
+	t.Cleanup(r.Stop)
+
+	_ = AsyncOnRunner(r, func() (int, error) {
+		return 1, nil
+	})
+	actual, err, ok := AsyncOnRunner(r, func() (int, error) {
+		return 2, nil
+	}).TryResult()
+
+	if !ok {
+		t.Fatalf("promise was not executed by the caller")
+	}
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if actual != 2 {
+		t.Logf("exp: %d", 2)
+		t.Logf("got: %d", actual)
+		t.Error("unexpected promise value")
+	}
+}
+
+func TestAsyncWithTimeoutIsRejectedWithTimeoutError(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	release := make(chan struct{})
+	var cause error
+	p := AsyncOnRunnerCtx(context.Background(), r, func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		cause = context.Cause(ctx)
+		// ignore cancelation for a while
+		<-release
+		return "late", nil
+	}, WithTimeout(10*time.Millisecond))
+
+	_, err := p.ResultTimeout(time.Second)
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("timeout error does not match context.DeadlineExceeded")
+	}
+
+	select {
+	case <-timeoutErr.Freed():
+		t.Fatalf("worker is freed while the function is running")
+	default:
+	}
+	close(release)
+	select {
+	case <-timeoutErr.Freed():
+	case <-time.After(time.Second):
+		t.Fatalf("worker is not freed after the function returned")
+	}
+	if cause != err {
+		t.Logf("exp: %v", err)
+		t.Logf("got: %v", cause)
+		t.Error("unexpected cause of context cancelation")
+	}
+}
+
+func TestAsyncWithTimeoutResolvesInTime(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	actual, err := AsyncOnRunner(r, func() (int, error) {
+		return 1, nil
+	}, WithTimeout(time.Second)).Result()
+	if err != nil || actual != 1 {
+		t.Logf("exp: 1 <nil>")
+		t.Logf("got: %v %v", actual, err)
+		t.Error("unexpected result")
+	}
+}
+
+func TestAsyncWithTimeoutHandedOffTaskSubmittedTwice(t *testing.T) {
+	r1 := NewRunner(0, DefaultRunnerCapacity)
+	p := AsyncOnRunner(r1, func() (int, error) {
+		return 1, nil
+	}, WithTimeout(time.Second))
+	tasks := r1.Handoff()
+	if len(tasks) != 1 {
+		t.Fatalf("unexpected number of handed off tasks: %d", len(tasks))
+	}
+
+	r2 := NewRunner(1, DefaultRunnerCapacity)
+	tasks[0].Submit(r2)
+	tasks[0].Submit(r2)
+	r2.Wait()
+
+	actual, err := p.Result()
+	if err != nil || actual != 1 {
+		t.Logf("exp: 1 <nil>")
+		t.Logf("got: %v %v", actual, err)
+		t.Error("unexpected result")
+	}
+}
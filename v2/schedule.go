@@ -0,0 +1,73 @@
+package promise
+
+import (
+	"context"
+	"time"
+)
+
+// AsyncAfter schedules impl for execution on the runner r once d elapses.
+// Until then impl occupies neither workers nor the queue of r, and canceling
+// the returned promise stops the timer. If r is shut down before d elapses,
+// then the returned promise is rejected with ErrExecutionDone.
+func AsyncAfter[T any](r *Runner, d time.Duration, impl func() (T, error), opts ...TaskOption) *Promise[T] {
+	promise := NewPromise[T]()
+	unschedule := r.schedule(d, newExecPromise(promise, impl).with(opts))
+	promise.whenSettled(unschedule)
+	return promise
+}
+
+// AsyncAt is the same as AsyncAfter, but impl is scheduled for execution at t
+func AsyncAt[T any](r *Runner, t time.Time, impl func() (T, error), opts ...TaskOption) *Promise[T] {
+	return AsyncAfter(r, time.Until(t), impl, opts...)
+}
+
+type delayedItem struct {
+	item  execPromise
+	timer *time.Timer
+}
+
+// schedule queues item on r once d elapses. The returned function stops the
+// timer if item is not queued yet.
+func (r *Runner) schedule(d time.Duration, item execPromise) func() {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		item.promise.Reject(ErrExecutionDone)
+		return func() {}
+	}
+
+	delayed := &delayedItem{item: item}
+	// timer function is blocked on r.mu until delayed is registered
+	delayed.timer = time.AfterFunc(d, func() {
+		r.mu.Lock()
+		_, ok := r.delayed[delayed]
+		delete(r.delayed, delayed)
+		r.mu.Unlock()
+		if ok {
+			r.enqueue(context.Background(), item)
+		}
+	})
+	r.delayed[delayed] = struct{}{}
+	r.mu.Unlock()
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if _, ok := r.delayed[delayed]; ok {
+			delete(r.delayed, delayed)
+			delayed.timer.Stop()
+		}
+	}
+}
+
+// takeDelayed stops timers of all scheduled items and returns their promises,
+// r.mu must be held
+func (r *Runner) takeDelayed() []Rejectable {
+	promises := make([]Rejectable, 0, len(r.delayed))
+	for delayed := range r.delayed {
+		delayed.timer.Stop()
+		promises = append(promises, delayed.item.promise)
+	}
+	clear(r.delayed)
+	return promises
+}
@@ -0,0 +1,70 @@
+package promise
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAsyncAfterExecutesOnceDelayElapses(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	start := time.Now()
+	p := AsyncAfter(r, 20*time.Millisecond, func() (time.Time, error) {
+		return time.Now(), nil
+	})
+
+	if _, _, ok := p.TryResult(); ok {
+		t.Fatalf("delayed promise is settled immediately")
+	}
+
+	executedAt, err := p.ResultTimeout(time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error %[1]v (%[1]T)", err)
+	}
+	if executedAt.Sub(start) < 20*time.Millisecond {
+		t.Errorf("delayed promise executed after %v", executedAt.Sub(start))
+	}
+}
+
+func TestAsyncAtCouldBeCanceledBeforeStart(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+	t.Cleanup(r.Wait)
+
+	executed := make(chan struct{}, 1)
+	p := AsyncAt(r, time.Now().Add(10*time.Millisecond), func() (string, error) {
+		executed <- struct{}{}
+		return "", nil
+	})
+	p.Cancel()
+
+	select {
+	case <-executed:
+		t.Fatalf("canceled delayed promise was executed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	r.mu.Lock()
+	delayed := len(r.delayed)
+	r.mu.Unlock()
+	if delayed != 0 {
+		t.Errorf("canceled delayed promise is still scheduled")
+	}
+}
+
+func TestAsyncAfterIsRejectedOnWait(t *testing.T) {
+	r := NewRunner(1, DefaultRunnerCapacity)
+
+	p := AsyncAfter(r, time.Hour, func() (string, error) {
+		return "", nil
+	})
+	r.Wait()
+
+	_, err := p.ResultTimeout(time.Second)
+	if !errors.Is(err, ErrExecutionDone) {
+		t.Logf("exp: %v", ErrExecutionDone)
+		t.Logf("got: %v", err)
+		t.Error("unexpected error of delayed promise on waited runner")
+	}
+}